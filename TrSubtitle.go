@@ -4,19 +4,17 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
+	"crypto/sha1"
 	"flag"
 	"fmt"
-	"github.com/gitote/chardet"
-	"github.com/huichen/sego"
+	"github.com/saintfish/chardet"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
 	"regexp"
-	"sort"
+	"runtime"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/traditionalchinese"
@@ -24,10 +22,12 @@ import (
 )
 
 type subpart struct {
-	SPos  int    `json:"sPos"`
-	STime string `json:"sTime"`
-	SCSub string `json:"sCSub"`
-	SSub  string `json:"sSub"`
+	SPos  int      `json:"sPos"`
+	STime string   `json:"sTime"`
+	SCSub string   `json:"sCSub"`
+	SSub  string   `json:"sSub"`
+	Flow  workflow `json:"-"`
+	SDH   sdhInfo  `json:"-"`
 }
 
 type subInfo struct {
@@ -35,29 +35,87 @@ type subInfo struct {
 	DCSub     string    `json:"dCSub"`
 	DESub     string    `json:"dESub"`
 	MNum      int       `json:"Num"`
+	DCHash    string    `json:"dCHash,omitempty"`
+	Type      string    `json:"type,omitempty"`
 	SplitInfo []subpart `json:"SplitInfo"`
+	Flow      workflow  `json:"-"`
 }
 
+//由json文件生成的字幕的第一条
+const jsfirstext = "1" + "\n" +
+	"00:00:00,000 --> 00:00:05,000" + "\n" +
+	"{\\pos(200,210)}由机翻双语字幕辅助软件直接生成，此字幕仅用于研究学习" + "\n" +
+	"url：github.com/jikaimail/SubtitleTranslation/" + "\n"
+
+//字幕时间轴，项目文件中的时间轴按同样的规则检查
+var subTimeReg = regexp.MustCompile(`^\d*:\d*:\d*\d*:*,\d* --> \d*:\d*:\d*\d*:*,\d*$`)
+
 type Subtitles struct {
 	Subtitles []subInfo `json:"Subtitles"`
 }
 
-type charCode struct {
-	Name string
-	num  int
-}
-
-type charCodes []charCode
-
 var (
-	h            bool
-	slang        string
-	sstype       string
-	infilepath   string
-	trfilepath   string
-	josnfilepath string
-	pgfilepath   string
-	nplinenum    int
+	h             bool
+	slang         string
+	sstype        string
+	infilepath    string
+	trfilepath    string
+	josnfilepath  string
+	pgfilepath    string
+	nplinenum     int
+	bresplit      bool
+	dictpath      string
+	udictpaths    string
+	oencname      string
+	eolname       string
+	iencname      string
+	outpath       string
+	jsoutpath     string
+	outdir        string
+	nametemplate  string
+	bforce        bool
+	srclang       string
+	tglang        string
+	convmode      string
+	convfilepath  string
+	convdictpath  string
+	batchpaths    string
+	brecurse      bool
+	nworkers      int
+	watchdir      string
+	watchinterval int
+	mkvtrack      int
+	blisttracks   bool
+	exportpath    string
+	importpath    string
+	diffpath      string
+	mergepath     string
+	basepath      string
+	breview       bool
+	bserve        bool
+	serveaddr     string
+	blistcomments bool
+	setstatus     string
+	assignee      string
+	commenttext   string
+	bresolve      bool
+	cuespec       string
+	linespec      string
+	username      string
+	bfinal        bool
+	punctbackend  string
+	pmodelpath    string
+	ptrainpaths   string
+	btruecase     bool
+	tccorpuspaths string
+	sdhmode       string
+	sdhdictpath   string
+	bclassify     bool
+	cuepolicyspec string
+	punctURL      string
+	punctMethod   string
+	punctField    string
+	punctResponse string
 )
 
 func init() {
@@ -68,7 +126,60 @@ func init() {
 	flag.StringVar(&josnfilepath, "jsfile", "", "enter the json file name here.")
 	flag.StringVar(&pgfilepath, "pfile", "", "Add punctuation to the original subtitles.")
 	flag.IntVar(&nplinenum, "npline", 6, "How many lines of subtitles are there without punctuation? ")
+	flag.StringVar(&sdhmode, "sdh", "", "SDH sound descriptions and speaker labels: strip translate keep.")
+	flag.StringVar(&sdhdictpath, "sdhdict", "", "enter the glossary file of sound descriptions and speakers for -sdh translate.")
+	flag.BoolVar(&bclassify, "classify", false, "Classify lyric, sign and credit cues and keep them out of sentence merging.")
+	flag.StringVar(&cuepolicyspec, "cuepolicy", "", "the translation policy and style of each cue type, e.g. lyric=translate:italic+notes,credit=drop.")
+	flag.BoolVar(&btruecase, "truecase", false, "Restore the case of all caps or lowercase original subtitles.")
+	flag.StringVar(&tccorpuspaths, "tccorpus", "", "enter the normally cased srt or text files for -truecase, separated by commas.")
+	flag.StringVar(&punctbackend, "punct", "offline", "punctuation backend for -pfile: offline remote.")
+	flag.StringVar(&pmodelpath, "pmodel", "", "enter the punctuation model file name here.")
+	flag.StringVar(&punctURL, "purl", defaultPunctURL, "the URL of the punctuation service for -punct remote.")
+	flag.StringVar(&punctMethod, "pmethod", "POST", "the HTTP method of the punctuation service: POST GET.")
+	flag.StringVar(&punctField, "pfield", "text", "the form field of the text sent to the punctuation service.")
+	flag.StringVar(&punctResponse, "presp", "text", "the response of the punctuation service: text json:field.")
+	flag.StringVar(&ptrainpaths, "ptrain", "", "enter the punctuated srt or text files to train the punctuation model, separated by commas.")
 	flag.StringVar(&sstype, "stype", "b", "this Subtitle option")
+	flag.BoolVar(&bresplit, "resplit", false, "Re-split the modified translations in the json file.")
+	flag.StringVar(&dictpath, "dict", "", "enter the segmentation dictionary file name here.")
+	flag.StringVar(&udictpaths, "udict", "", "enter the user dictionary file names here, separated by commas.")
+	flag.StringVar(&srclang, "srclang", "en", "the language of the original subtitles.")
+	flag.StringVar(&tglang, "tglang", "zh", "the language of the translation.")
+	flag.StringVar(&convmode, "conv", "", "Chinese conversion: s2t t2s s2tw s2hk.")
+	flag.StringVar(&convfilepath, "convfile", "", "enter the srt or json file name to convert here.")
+	flag.StringVar(&convdictpath, "convdict", "", "enter the folder of the OpenCC dictionaries (STCharacters.txt ...) for -conv.")
+	flag.StringVar(&oencname, "oenc", "utf-8", "output encoding: utf-8 utf-8-bom gbk gb18030 big5 utf-16le utf-16be.")
+	flag.StringVar(&eolname, "eol", "lf", "output line ending: lf crlf.")
+	flag.StringVar(&iencname, "ienc", "", "input encoding, detected automatically by default.")
+	flag.StringVar(&outpath, "o", "", "enter the output file name here, - for standard output.")
+	flag.StringVar(&jsoutpath, "jsout", "", "enter the output json file name here, - for standard output.")
+	flag.StringVar(&outdir, "outdir", "", "enter the output folder here.")
+	flag.StringVar(&nametemplate, "name", "", "output file name template, e.g. {base}.{lang}.{type}")
+	flag.BoolVar(&bforce, "force", false, "overwrite existing output files.")
+	flag.StringVar(&batchpaths, "batch", "", "enter the folders or wildcards to process, separated by commas.")
+	flag.BoolVar(&brecurse, "r", false, "include subfolders in batch mode.")
+	flag.IntVar(&nworkers, "workers", runtime.NumCPU(), "number of files processed at the same time in batch mode.")
+	flag.StringVar(&watchdir, "watch", "", "enter the folder to watch here.")
+	flag.IntVar(&watchinterval, "interval", 2, "seconds a file must stay unchanged before it is processed in watch mode.")
+	flag.IntVar(&mkvtrack, "track", 0, "the subtitle track number to extract from a Matroska file.")
+	flag.BoolVar(&blisttracks, "listtracks", false, "list the subtitle tracks of the Matroska file.")
+	flag.StringVar(&exportpath, "export", "", "export the json file for translation tools or reviewers, e.g. a.xlf a.csv")
+	flag.StringVar(&importpath, "import", "", "import translations into the json file, e.g. a.xlf a.csv")
+	flag.StringVar(&diffpath, "diff", "", "enter the json file to compare with the -jsfile json file.")
+	flag.StringVar(&mergepath, "merge", "", "enter the json file whose changes are merged into the -jsfile json file.")
+	flag.StringVar(&basepath, "base", "", "enter the original json file both copies were made from, for -merge.")
+	flag.BoolVar(&breview, "review", false, "review and edit the json file sentence by sentence.")
+	flag.BoolVar(&bserve, "serve", false, "review the json file in the browser.")
+	flag.StringVar(&serveaddr, "addr", "127.0.0.1:8080", "the address of the review page for -serve.")
+	flag.BoolVar(&blistcomments, "comments", false, "list the open comments in the json file.")
+	flag.StringVar(&setstatus, "status", "", "set the review status: mt post-edited reviewed approved.")
+	flag.StringVar(&assignee, "assign", "", "assign the sentences or lines to this person.")
+	flag.StringVar(&commenttext, "comment", "", "add a comment to the sentences or lines.")
+	flag.BoolVar(&bresolve, "resolve", false, "mark the comments of the sentences or lines as resolved.")
+	flag.StringVar(&cuespec, "cue", "", "the sentence numbers for -status -assign -comment -resolve, e.g. 3,5-8")
+	flag.StringVar(&linespec, "line", "", "the subtitle line numbers for -status -assign -comment -resolve, e.g. 3,5-8")
+	flag.StringVar(&username, "user", "", "the reviewer name recorded with changes and comments.")
+	flag.BoolVar(&bfinal, "final", false, "generate the subtitle only if all lines are approved.")
 
 	// 改变默认的 Usage，flag包中的Usage 其实是一个函数类型。这里是覆盖默认函数实现，具体见后面Usage部分的分析
 	flag.Usage = l_usage
@@ -79,7 +190,7 @@ func l_usage() {
 
 	if slang == "en" {
 		fmt.Fprintf(os.Stderr,
-			`Subtitle translation / version: TrSubtitle/0.5  
+			`Subtitle translation / version: TrSubtitle/0.6  
    by jikai Email:jikaimail@gmail.com
 Usage: 
   This software is used to extract the original text content in the untitled SRT
@@ -98,23 +209,188 @@ matches the line position and total number of lines in the original content.
   If you need to further adjust the subtitles, you can correct the subtitle 
 content in the json file;The program regenerates the required subtitle file 
 according to the adjusted json file.(only support this software json format)
+  The json project file records the original subtitle file and its hash, the 
+languages and the tool version; 0.5 json files are read directly and are 
+converted when a command saves the json file (the original is kept as .bak).
+5)TrSubtitle -jsfile json filename -resplit
+  If you only corrected the whole sentence translations ("translation" of the 
+cues) in the json file, the program re-splits the changed sentences into subtitle lines and regenerates
+the subtitle file.
 Options:
 -h : help
 -lang : chs display Chinese help en display English help. Default chs.
 -infile : Enter the name of the original subtitle file to be processed 
-  (requires unformatted SRT subtitle file)
+  (requires unformatted SRT subtitle file), or a Matroska file (.mkv .mks 
+  .webm) with a text subtitle track (SRT ASS SSA WebVTT).
 -trfile : Enter the name of the translation file.
 -jsfile : Enter the json file name.
 -stype : o Generate translated subtitle file 
          b Generate bilingual subtitle files  Default b.
--pfile : Add punctuation to the original subtitles(Europarl Corpus)
+-pfile : Add punctuation to the original subtitles.
 -npline : How many lines of subtitles are there without punctuation? default 6
+-sdh : SDH sound descriptions ([DOOR SLAMS] (laughs) ♪♪) and speaker labels 
+  (JOHN:): strip (remove the descriptions) translate (translate them with
+  -sdhdict) keep (keep them untranslated). They are not written to the
+  .en.txt file; speakers are kept per line in the json file and added to
+  the translated lines (each after its dialogue dash, "- JOHN: Hi. - MARY: 
+  Bye."). In translate mode without -sdhdict the translated lines get no 
+  speakers. Brackets without a letter, such as (1), are kept as text. 
+  Default no SDH processing.
+-sdhdict : Enter the glossary of sound descriptions and speakers, one 
+  "original=translation" per line, e.g. door slams=门砰地关上
+-classify : Classify lyric (♪ or #), sign ({\an8} or all caps) and credit 
+  (Subtitles by, URLs) cues and keep them out of sentence merging.
+-cuepolicy : The policy of each cue type, type=action:styles. Actions: 
+  translate keep (not written to .en.txt) drop. Styles: plain italic top
+  notes, joined with +. Default lyric=translate:italic+notes,
+  sign=translate:top,credit=keep
+-truecase : Restore sentence case and proper nouns of ALL CAPS or lowercase 
+  original subtitles before the .en.txt file is written. The case of each
+  word is learned from -tccorpus (required) and -udict.
+-tccorpus : Enter normally cased srt or text files (wildcards allowed, 
+  separated by commas) to learn the case of words for -truecase, e.g. 
+  other episodes of the show. There is no built-in corpus, use at least 
+  20000 words; words not found are written in lowercase.
+-punct : Punctuation backend for -pfile: offline (a model trained with -ptrain) 
+         remote (the service at -purl). Default offline. Sentences that
+         fail are reported and left unpunctuated. Lyrics and signs 
+         (-classify) are not punctuated.
+-purl : The URL of the punctuation service. 
+         Default http://bark.phon.ioc.ee/punctuator (Europarl Corpus).
+-pmethod : The HTTP method of the punctuation service: POST (form) 
+         GET (query). Default POST.
+-pfield : The field name of the text sent to the service. Default text.
+-presp : The response of the service: text (the punctuated text) 
+         json:field (a JSON field, e.g. json:data.text). Default text.
+-pmodel : Enter the punctuation model file name. Default punctuation.model 
+  in the current or program folder. There is no built-in model, without a 
+  model trained with -ptrain -punct offline leaves the text unpunctuated 
+  with a warning; an invalid model file is an error.
+-ptrain : Enter punctuated srt or text files (wildcards allowed, separated 
+  by commas) to train the punctuation model, saved to -pmodel or punctuation.model.
+  Use at least 20000 words of subtitles similar to the ones to punctuate.
+-resplit : Re-split the modified sentence translations in the json file
+  (an old json file without translation hashes only records them the first time).
+-dict : Enter the segmentation dictionary file name. Default dictionary.txt 
+  in the current or program folder, otherwise the small built-in dictionary 
+  (a few hundred common words) with a warning.
+-udict : Enter user dictionary file names (show names, slang), separated 
+  by commas. They are loaded on top of the segmentation dictionary.
+-srclang : Language of the original subtitles: en zh ja, others are split 
+  by character. Default en.
+-tglang : Language of the translation: zh en ja, others are split by 
+  character. Default zh.
+-conv : Basic Chinese conversion of common characters and phrases: s2t t2s 
+  s2tw(Taiwan phrases) s2hk(Hong Kong variants). The built-in tables cover 
+  about 1000 characters and 200 phrases, other characters are not converted;
+  characters of the result outside Big5 (GB2312 for t2s) are listed.
+  With -trfile or -jsfile, the converted subtitle (.cht.srt) is generated 
+  together with the .chs.srt.
+-convfile : Enter an existing srt or json file name to convert by -conv.
+  Default conversion s2t.
+-convdict : Enter the folder of the OpenCC dictionaries (STCharacters.txt 
+  STPhrases.txt TSCharacters.txt TSPhrases.txt TWPhrases.txt TWVariants.txt 
+  HKVariants.txt) to use instead of the built-in tables for a complete conversion.
+-oenc : Output encoding of the .chs.srt .en.txt .en.srt files: utf-8 
+  utf-8-bom gbk gb18030 big5 utf-16le utf-16be. Default utf-8.
+-eol : Output line ending: lf crlf. Default lf.
+-ienc : Encoding of the input srt, translation and json files, e.g. gbk 
+  big5 shift_jis windows-1252 utf-16le. Detected automatically by default.
+-o : Enter the output file name (.en.txt .chs.srt .en.srt). 
+-jsout : Enter the output json file name. Default original subtitle file 
+  name + .json.
+  - can be used as the file name of -infile -trfile -jsfile -pfile 
+  -convfile (standard input) and -o -jsout (standard output). When the 
+  input is standard input, the output defaults to standard output. 
+  All messages are written to standard error, for example:
+  TrSubtitle -infile - < a.srt | translate | TrSubtitle -infile a.srt -trfile - > a.chs.srt
+-outdir : Enter the output folder. Default the folder of the input file.
+-name : Output file name template. {base} input file name without .srt 
+  .json, {lang} language tag (en zh-Hans zh-Hant), {type} srt txt json.
+  e.g. -name {base}.{lang}.{type}  generates Movie.zh-Hans.srt
+-force : Overwrite existing output files. Existing files are not 
+  overwritten by default (a json file without translations can be updated),
+  the program stops with exit status 1.
+-batch : Enter folders or wildcards (e.g. Season1/*.srt), separated by commas.
+  Every original srt subtitle is processed: when a translation named 
+  Movie.chs.txt Movie.zh.txt Movie.srt.chs.txt or Movie.srt.zh.txt exists, 
+  the subtitle is generated, otherwise the original text to be translated is
+  generated. A summary table (OK WARN FAIL SKIP) is printed at the end, 
+  the exit status is 1 when a file failed.
+-r : Include subfolders in batch mode.
+-workers : Number of files processed at the same time in batch mode. 
+  Default the number of CPUs.
+-watch : Enter a folder to watch. A new original srt subtitle generates the 
+  original text to be translated, a translation (named as in -batch) 
+  generates the subtitle, and an edited json file regenerates the subtitle.
+  Processed files are recorded in .trsubtitle-watch.json in the folder.
+-interval : Seconds a file must stay unchanged before it is processed in 
+  watch mode (also the polling interval). Default 2.
+-export : Export the json file given by -jsfile for CAT tools (Trados 
+  memoQ OmegaT): .xlf .xliff (XLIFF 2.0). Formatting tags are protected, 
+  subtitle lines and timings are written as metadata and notes.
+  Or for translation platforms (Weblate Pootle): .po .pot (Gettext), the 
+  context is the sentence number and timing, the subtitle lines and the 
+  previous and next sentences are written as comments. Machine translations 
+  not yet post-edited, reviewed or approved are marked fuzzy.
+  Or for reviewers (spreadsheets): .csv .tsv, one row per subtitle line with 
+  index, start, end, duration, cps, source, target, sentence and notes.
+-import : Import the translated file (.xlf .xliff .po .csv .tsv) into the 
+  json file given by -jsfile, re-split the changed sentences and generate the 
+  subtitle. XLIFF states map to the review status (initial mt, translated 
+  post-edited, reviewed reviewed, final approved); an unchanged translation 
+  keeps a higher status. 
+  Untranslated and fuzzy sentences are reported and keep their previous 
+  translation. Spreadsheet rows replace the lines directly and the notes 
+  are saved as comments of the line; nothing is imported if rows were added 
+  or removed or the timing was changed.
+-diff : Compare the json file given by -jsfile with this json file sentence 
+  by sentence (translation, status, line timing and text), e.g. 
+  TrSubtitle -jsfile a.srt.json -diff b.srt.json
+-merge : Merge the changes of this json file into the json file given by 
+  -jsfile (or save to -jsout). Sentences changed in only one file are merged
+  automatically, sentences changed differently in both files get conflict 
+  markers (<<<<<<< ======= >>>>>>>) and are listed; timings changed 
+  differently keep the -jsfile timing and are listed, e.g. 
+  TrSubtitle -jsfile a.srt.json -merge b.srt.json -base orig.srt.json
+-base : The original json file both copies were made from, for -merge.
+-review : Review the json file given by -jsfile sentence by sentence in the 
+  terminal: the original and translation, each line with its timing and 
+  characters per second, and warnings (no translation, too fast, too long).
+  Edit the sentence or a line, move the split point between lines one word 
+  left or right, jump to the next warning; saving re-generates the subtitle.
+-serve : Review the json file given by -jsfile in the browser: a source and 
+  target table with inline editing, split points moved by dragging, search, 
+  filters (untranslated, over CPS, with warnings or comments) and download of the SRT or 
+  ASS subtitle. Every change is saved to the json file and re-generates the 
+  subtitle; save or render errors are shown on the page.
+-addr : Address of the -serve review page. Default 127.0.0.1:8080 (this 
+  computer only).
+-status : Set the review status of sentences or lines in the json file given 
+  by -jsfile: mt post-edited reviewed approved. Edits made by -import, 
+  -review and -serve set post-edited and record the time and -user. The 
+  status is only lowered when the translation was changed.
+-assign : Assign the sentences or lines to a person.
+-comment : Add a comment (e.g. a question for the translator), requires -cue
+  or -line.
+-resolve : Mark the comments of the sentences or lines as resolved.
+-cue : Sentence numbers for -status -assign -comment -resolve, e.g. 3,5-8.
+  Default all sentences.
+-line : Subtitle line numbers for -status -assign -comment -resolve, e.g. 
+  12,14-16, instead of whole sentences.
+-user : Reviewer name recorded with changes and comments. Default the 
+  system user name.
+-comments : List the open comments in the json file given by -jsfile.
+-final : With -jsfile, generate the subtitle only if all lines are approved.
+-listtracks : List the subtitle tracks of the Matroska file given by -infile.
+-track : Subtitle track number to extract from the Matroska file. Default 
+  the first text subtitle track in the -srclang language.
 latest version:【https://github.com/jikaimail/SubtitleTranslation/releases】
 `)
 
 	} else {
 		fmt.Fprintf(os.Stderr,
-			`机翻双语字幕辅助软件/版本 : TrSubtitle/0.5
+			`机翻双语字幕辅助软件/版本 : TrSubtitle/0.6
                   by jikai  Email:jikaimail@gmail.com
    此软件用于将无格式的SRT原文字幕中的原文内容提取为待译原文；
 使用者通过机翻网站或者人工翻译将待译原文翻译成为译文；
@@ -128,15 +404,132 @@ latest version:【https://github.com/jikaimail/SubtitleTranslation/releases】
 4) TrSubtitle -jsfile json文件名
 如果需要对字幕进一步调整，可在json文件内对字幕内容进行修正；
 程序根据调整后的json文件，重新生成所需的字幕文件。(仅支持本软件json格式)   
+json项目文件记录原文字幕文件名及摘要、语言及软件版本；0.5版本的json文件
+可直接读取，保存json文件的命令将其转换为新格式(原文件保存为.bak)。
+5) TrSubtitle -jsfile json文件名 -resplit
+如果仅修正了json文件内各句的整句译文(translation)，程序将重新切分被修改的句子，
+并重新生成所需的字幕文件。
 参数选项:
 -h : 帮助
 -lang   : chs显示中文帮助 en显示英文帮助. 默认chs.
--infile : 输入要处理的原文字幕文件名(需要无格式的SRT字幕文件)
+-infile : 输入要处理的原文字幕文件名(需要无格式的SRT字幕文件)，或包含文本字幕轨道
+          (SRT ASS SSA WebVTT)的Matroska文件(.mkv .mks .webm).
 -trfile : 输入译文文件名.
 -jsfile : 输入json文件名.
 -stype  : o 仅生成译文字幕 b 生成双语字幕文件 默认b.  
--pfile  : 为原文字幕添加标点符号.(仅Europarl Corpus)
+-pfile  : 为原文字幕添加标点符号.
 -npline : 多少行原文字幕无标点符号时提示？默认 6
+-sdh    : 听障字幕(SDH)的处理方式: strip 删除声音描述 translate 按-sdhdict翻译
+          声音描述 keep 保留声音描述原文. 声音描述([DOOR SLAMS] (laughs) ♪♪)
+          及说话人(JOHN:)不写入.en.txt，说话人保存在json文件中并加到译文行首(一行
+          有多段破折号对白时分别加在各段前). translate 没有-sdhdict时译文不加说话人.
+          括号内没有字母的(如 (1))不是声音描述. 默认不处理.
+-sdhdict : 输入声音描述及说话人词典，每行 原文=译文，如 door slams=门砰地关上
+-classify : 区分歌词(♪ #)、屏幕文字({\an8}或全大写)、字幕组信息(Subtitles by、
+          网址等)，非对白的字幕单独成句，不与前后的对白合并.
+-cuepolicy : 各类字幕的处理方式及样式，类型=方式:样式. 方式: translate 翻译 
+          keep 保留原文(不写入.en.txt) drop 删除. 样式: plain italic top notes，
+          多个样式用+连接. 默认 lyric=translate:italic+notes,
+          sign=translate:top,credit=keep
+-truecase : 恢复全大写或全小写原文字幕的大小写(句首及专有名词)，在生成.en.txt之前处理.
+          词的写法取自 -tccorpus 语料(必须)及 -udict 用户词典.
+-tccorpus : 输入大小写正常的srt或文本文件名(可用通配符，多个用逗号分隔)，
+          供 -truecase 学习各词的写法，如同一剧集的其它字幕. 没有内置语料，
+          建议至少20000词；语料中没有的词为小写.
+-punct  : -pfile 的标点方式: offline 离线标点模型(由-ptrain训练) 
+          remote 访问-purl指定的标点服务. 默认offline. 
+          某句添加标点失败时保留原文并提示. 歌词及屏幕文字(-classify)不添加标点.
+-purl   : 标点服务地址. 默认http://bark.phon.ioc.ee/punctuator(仅Europarl Corpus).
+-pmethod : 标点服务的请求方式: POST(表单) GET(查询参数). 默认POST.
+-pfield : 发送原文使用的字段名. 默认text.
+-presp  : 标点服务的响应: text 响应即为结果 
+          json:字段 取JSON中的字段(如json:data.text). 默认text.
+-pmodel : 输入标点模型文件名. 默认使用当前目录或程序目录下的punctuation.model.
+          没有内置模型，未用 -ptrain 训练模型时 -punct offline 不添加标点并提示警告；
+          模型文件格式错误时出错退出.
+-ptrain : 输入带标点的srt或文本文件名(可用通配符，多个用逗号分隔)训练标点模型，
+          保存到-pmodel或punctuation.model. 建议使用至少20000词的同类字幕.
+-resplit : 重新切分json文件内被修改的整句译文(旧版json文件首次运行时只记录
+          译文摘要，不重新切分).
+-dict   : 输入分词词典文件名. 默认使用当前目录或程序目录下的dictionary.txt，
+          未发现时使用只有几百个常用词的内置词典并提示警告.
+-udict  : 输入用户词典文件名(剧集人名、俚语等)，多个文件用逗号分隔.
+-srclang : 原文字幕语言: en zh ja，其它语言按字切分. 默认en.
+-tglang : 译文语言: zh en ja，其它语言按字切分. 默认zh.
+-conv   : 常用字简繁转换 s2t 简转繁 t2s 繁转简 s2tw 简转台湾繁体(含用词) s2hk 简转香港
+          繁体(异体字). 内置转换表约1000个常用字及200个词组，其它字词不转换；
+          转换结果中不属于Big5(t2s 为GB2312)的字被列出.
+          与-trfile或-jsfile一起使用时，同时生成.chs.srt和.cht.srt字幕.
+-convfile : 输入要进行简繁转换的srt或json文件名，按-conv转换，默认s2t.
+-convdict : 输入OpenCC词典目录(STCharacters.txt STPhrases.txt TSCharacters.txt 
+          TSPhrases.txt TWPhrases.txt TWVariants.txt HKVariants.txt)，代替内置
+          转换表进行完整的简繁转换.
+-oenc   : .chs.srt .en.txt .en.srt 文件的输出字符集: utf-8 utf-8-bom gbk gb18030
+          big5 utf-16le utf-16be. 默认utf-8.
+-eol    : 输出文件换行符: lf crlf. 默认lf.
+-ienc   : 输入的字幕、译文及json文件的字符集，如 gbk big5 shift_jis windows-1252
+          utf-16le. 默认自动判断.
+-o      : 输入输出文件名(.en.txt .chs.srt .en.srt).
+-jsout  : 输入输出json文件名. 默认为原文字幕文件名+.json.
+          -infile -trfile -jsfile -pfile -convfile 的文件名为 - 时由标准输入读取，
+          -o -jsout 的文件名为 - 时输出到标准输出；输入为标准输入时默认输出到
+          标准输出。所有提示信息输出到标准错误，例如：
+          TrSubtitle -infile - < a.srt | 翻译 | TrSubtitle -infile a.srt -trfile - > a.chs.srt
+-outdir : 输入输出目录. 默认为输入文件所在目录.
+-name   : 输出文件名模板. {base} 不含.srt .json的输入文件名，{lang} 语言标记
+          (en zh-Hans zh-Hant)，{type} 文件类型 srt txt json.
+          例如 -name {base}.{lang}.{type} 生成 Movie.zh-Hans.srt
+-force  : 覆盖已存在的输出文件. 默认不覆盖已存在的文件(未包含译文的json文件除外)，
+          程序以退出码 1 结束.
+-batch  : 输入要批量处理的目录或通配符(如 Season1/*.srt)，多个用逗号分隔.
+          逐个处理原文srt字幕：存在 Movie.chs.txt Movie.zh.txt Movie.srt.chs.txt
+          或 Movie.srt.zh.txt 译文时生成字幕，否则生成待译原文.
+          处理完成后输出汇总表(OK WARN FAIL SKIP)，有 FAIL 时退出码为 1.
+-r      : 批量处理时包含子目录.
+-workers : 批量处理时同时处理的文件数. 默认为CPU数.
+-watch  : 输入要监视的目录. 出现新的原文srt字幕时生成待译原文，出现译文(命名
+          同-batch)时生成字幕，json文件修改后重新生成字幕. 已处理的文件记录在
+          目录内的.trsubtitle-watch.json.
+-interval : 监视目录时，文件无变化多少秒后再处理(也是定时扫描间隔). 默认2.
+-export : 将-jsfile指定的json文件导出为翻译工具(Trados memoQ OmegaT)使用的文件:
+          .xlf .xliff (XLIFF 2.0). 格式标记受保护，各行字幕及时间轴写入元数据及注释.
+          或翻译平台(Weblate Pootle)使用的文件: .po .pot (Gettext)，上下文为句子序号
+          及时间轴，各行字幕及前后句原文写入注释，未经译后编辑、审校或批准的机器
+          翻译标记为待确认(fuzzy).
+          或审校使用的表格文件: .csv .tsv，每行字幕一行，包括序号、开始及结束时间、
+          时长、每秒字数、原文、译文、句子序号及备注.
+-import : 将翻译后的文件(.xlf .xliff .po .csv .tsv)导入-jsfile指定的json文件，重新
+          切分被修改的句子并生成字幕. XLIFF的initial translated reviewed final
+          状态分别设为mt post-edited reviewed approved.
+          提示未翻译及待确认(fuzzy)的句子，这些句子保留原译文. 表格文件直接替换各行
+          译文，备注保存为该行的评论；行被增删或时间轴被修改时不导入.
+-diff   : 逐句比较-jsfile指定的json文件与此json文件(译文、状态、各行时间轴及译文)，
+          例如 TrSubtitle -jsfile a.srt.json -diff b.srt.json
+-merge  : 将此json文件的修改合并到-jsfile指定的json文件(或保存到-jsout). 仅一方修改
+          的内容自动合并，双方修改不同时写入冲突标记(<<<<<<< ======= >>>>>>>)并列出，
+          时间轴双方修改不同时保留-jsfile的时间轴并列出，
+          例如 TrSubtitle -jsfile a.srt.json -merge b.srt.json -base orig.srt.json
+-base   : -merge 时双方修改前的原始json文件.
+-review : 在终端中逐句审校-jsfile指定的json文件：显示原文、译文、各行时间轴及每秒
+          字数，以及警告(无译文、语速过快、行过长). 可修改整句或一行译文，左右移动
+          行之间的切分点，转到下一个警告；保存时重新生成字幕.
+-serve  : 在浏览器中审校-jsfile指定的json文件：原文译文对照表格，直接修改译文，拖动
+          移动切分点，搜索及筛选(未翻译、语速过快、有警告或评论)，下载SRT或ASS字幕. 每次
+          修改都保存到json文件并重新生成字幕，失败时网页提示错误.
+-addr   : -serve 审校网页的地址. 默认127.0.0.1:8080(仅本机可以访问).
+-status : 设置-jsfile指定的json文件中句子或行的审校状态: mt(机器翻译) post-edited(译后
+          编辑) reviewed(已审校) approved(已批准). 通过 -import -review -serve 修改
+          时设为 post-edited，并记录修改时间及 -user. 译文未修改时不降低状态.
+-assign : 将句子或行分配给指定的人.
+-comment : 添加评论(如给译者的问题)，需要 -cue 或 -line 参数.
+-resolve : 将句子或行的评论标记为已解决.
+-cue    : -status -assign -comment -resolve 的句子序号，例如 3,5-8. 默认所有句子.
+-line   : -status -assign -comment -resolve 的字幕行序号，例如 12,14-16，代替句子.
+-user   : 修改及评论时记录的审校人. 默认为系统用户名.
+-comments : 列出-jsfile指定的json文件中未解决的评论.
+-final  : 与-jsfile一起使用，所有行都已批准时才生成字幕.
+-listtracks : 列出-infile指定的Matroska文件中的字幕轨道.
+-track  : 要提取的Matroska字幕轨道号. 默认为第一个-srclang语言的文本字幕轨道.
 最新版本：【https://github.com/jikaimail/SubtitleTranslation/releases】
 `)
 
@@ -144,16 +537,6 @@ latest version:【https://github.com/jikaimail/SubtitleTranslation/releases】
 
 }
 
-func (p charCodes) Len() int { return len(p) }
-
-func (p charCodes) Less(i, j int) bool {
-	return p[i].num > p[j].num
-}
-
-func (p charCodes) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
-}
-
 func checkError(e error) {
 	if e != nil {
 		panic(e)
@@ -245,87 +628,82 @@ func ContainSym(tsym string) bool {
 	return bresult
 }
 
-func JsonGenSub() {
-
+func checkJsonFile() {
 	_, lerr := os.Stat(josnfilepath)
-	if os.IsNotExist(lerr) {
+	if josnfilepath != "-" && os.IsNotExist(lerr) {
 		if slang == "en" {
-			fmt.Print("No json files found:" + josnfilepath)
-			fmt.Print("-jsfile json filename" + "\n")
+			fmt.Fprint(os.Stderr, "No json files found:"+josnfilepath)
+			fmt.Fprint(os.Stderr, "-jsfile json filename"+"\n")
 		} else {
-			fmt.Print("未发现json文件:" + josnfilepath)
-			fmt.Print("-jsfile json 文件名 " + "\n")
+			fmt.Fprint(os.Stderr, "未发现json文件:"+josnfilepath)
+			fmt.Fprint(os.Stderr, "-jsfile json 文件名 "+"\n")
 		}
-		os.Exit(0)
+		os.Exit(1)
 	}
+}
 
-	var jSub Subtitles
+//由json文件生成的默认字幕文件名：Movie.srt.json -> Movie.chs.srt
+func jsonChsFileName(jspath string) string {
+	if strings.HasSuffix(strings.ToLower(jspath), ".json") {
+		tempath := jspath[0 : len(jspath)-5]
+		if strings.HasSuffix(strings.ToLower(tempath), ".srt") || isMkvFile(tempath) {
+			return chsFileName(tempath)
+		}
+	}
+	return jspath + ".txt"
+}
 
-	jsfile, _ := ioutil.ReadFile(josnfilepath)
-	//去掉utf8 BOM标志
-	jsfile = bytes.Replace(jsfile, []byte("\uFEFF"), []byte(""), 1)
+//由json文件生成的字幕文件名
+func projectSubFileName() string {
+	return outFileName(josnfilepath, jsonChsFileName(josnfilepath), langTag(tglang), typeSrt)
+}
 
-	_ = json.Unmarshal([]byte(jsfile), &jSub.Subtitles)
+func JsonGenSub() {
 
-	jschsfilename := ""
+	checkJsonFile()
 
-	if strings.HasSuffix(strings.ToLower(josnfilepath), ".json") {
-		tempath := josnfilepath[0 : len(josnfilepath)-5]
-		if strings.HasSuffix(strings.ToLower(tempath), ".srt") {
-			jschsfilename = josnfilepath[0:len(tempath)-4] + ".chs.srt"
-		} else {
-			jschsfilename = josnfilepath + ".txt"
-		}
+	project := readProject(josnfilepath)
+	checkOutput(renderProject(project))
+}
 
-	} else {
-		jschsfilename = josnfilepath + ".txt"
+//由项目生成字幕文件，文件名按 -jsfile 参数确定；出错时返回 error，由调用方提示
+func renderProject(project *subProject) error {
+	checkProjectSource(project)
+	if ferr := checkFinal(project); ferr != nil {
+		return ferr
+	}
+	if hasConflict(project) {
+		printWarning("The json file contains unresolved conflict markers (<<<<<<<): "+josnfilepath,
+			"json文件中有未解决的冲突标记(<<<<<<<): "+josnfilepath)
 	}
 
-	del_file(jschsfilename)
+	jschsfilename := projectSubFileName()
 
-	modifyfile, mErr := os.OpenFile(jschsfilename, os.O_CREATE|os.O_WRONLY, os.ModeAppend)
-	checkError(mErr)
+	modifyfile, mErr := openSubFile(jschsfilename)
+	if mErr != nil {
+		return mErr
+	}
 	defer modifyfile.Close()
 
-	jssubtext := ""
-
-	//根据json 文件直接生成双语字幕
-	//增加传播字幕行，让更多人受益。
-	jsfirstext := "1" + "\n" +
-		"00:00:00,000 --> 00:00:05,000" + "\n" +
-		"{\\pos(200,210)}由机翻双语字幕辅助软件直接生成，此字幕仅用于研究学习" + "\n" +
-		"url：github.com/jikaimail/SubtitleTranslation/" + "\n"
-	_, werr := modifyfile.WriteString(jsfirstext)
-	checkError(werr)
-
-	for jspos := range jSub.Subtitles {
-
-		for spos := range jSub.Subtitles[jspos].SplitInfo {
-			if sstype == "b" {
-				jssubtext = strconv.Itoa(jSub.Subtitles[jspos].SplitInfo[spos].SPos+1) + "\n" +
-					jSub.Subtitles[jspos].SplitInfo[spos].STime + "\n" +
-					jSub.Subtitles[jspos].SplitInfo[spos].SCSub + "\n" +
-					jSub.Subtitles[jspos].SplitInfo[spos].SSub + "\n"
-			} else {
-				jssubtext = strconv.Itoa(jSub.Subtitles[jspos].SplitInfo[spos].SPos+1) + "\n" +
-					jSub.Subtitles[jspos].SplitInfo[spos].STime + "\n" +
-					jSub.Subtitles[jspos].SplitInfo[spos].SCSub + "\n"
-			}
-			_, werr := modifyfile.WriteString(jssubtext)
-			checkError(werr)
-		}
+	if _, werr := modifyfile.WriteString(jsonSubText(project.subs())); werr != nil {
+		return werr
+	}
+	if cerr := modifyfile.Close(); cerr != nil {
+		return cerr
 	}
 	if slang == "en" {
-		fmt.Println("Generate subtitle file from json file. ")
-		fmt.Println("Please check the file: " + jschsfilename + " ." + "\n")
+		fmt.Fprintln(os.Stderr, "Generate subtitle file from json file. ")
+		fmt.Fprintln(os.Stderr, "Please check the file: "+jschsfilename+" ."+"\n")
 	} else {
-		fmt.Println("由json文件生成字幕文件.")
-		fmt.Println("请查看文件: " + jschsfilename + " ." + "\n")
+		fmt.Fprintln(os.Stderr, "由json文件生成字幕文件.")
+		fmt.Fprintln(os.Stderr, "请查看文件: "+jschsfilename+" ."+"\n")
 	}
-	os.Chmod(jschsfilename, 0644)
+	return convAfterMerge(jschsfilename, josnfilepath)
 }
 
-func oSubGentrText(inpath string) []subInfo {
+//读取辅助json文件
+//enpath 为待译原文文件名，为空时不生成待译原文文件
+func oSubGentrText(inpath string, enpath string) []subInfo {
 	var insub []subInfo
 	var CurSub subInfo
 	var curpart subpart
@@ -340,17 +718,38 @@ func oSubGentrText(inpath string) []subInfo {
 	lend := false
 	bnpline := false
 
-	file, err := os.Open(inpath)
+	//确定原文字幕字符集并转换为utf-8，Matroska文件提取其中的文本字幕
+	var intext []byte
+	var incharset string
+	var err error
+	if isMkvFile(inpath) {
+		intext, err = extractMkvSub(inpath)
+		checkMkvError(inpath, err)
+		incharset = "UTF-8"
+	} else {
+		intext, incharset, err = readTextFile(inpath)
+	}
 	checkError(err)
-	defer file.Close()
-
-	del_file(inpath + ".en.txt")
-
-	enfile, enErr := os.OpenFile(inpath+".en.txt", os.O_CREATE|os.O_WRONLY, os.ModeAppend)
-	checkError(enErr)
-	defer enfile.Close()
+	if incharset != "UTF-8" {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Determine the character set of the subtitle file："+incharset+"\n")
+		} else {
+			fmt.Fprintln(os.Stderr, "确定原文字幕文件的字符集为："+incharset+"\n")
+		}
+	}
+	truecaser := loadTrueCaser(intext)
+	cuetypes := classifyCues(intext)
+	curtype := ""
+
+	var enfile *subWriter
+	if len(enpath) > 0 {
+		var enErr error
+		enfile, enErr = openSubFile(enpath)
+		checkOutput(enErr)
+		defer enfile.Close()
+	}
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(intext))
 	for scanner.Scan() {
 		subText := scanner.Text()
 
@@ -373,32 +772,34 @@ func oSubGentrText(inpath string) []subInfo {
 		}
 		if linereg.MatchString(subText) {
 			if strconv.Itoa(lineCn) == subText {
-				if lineCn > 1 && lend {
+				//歌词、屏幕文字等单独成句
+				if lineCn > 1 && len(strings.TrimSpace(NewSub)) > 0 &&
+					(lend || cueBreaks(CurSub.Type) || cueBreaks(cuetypes[lineCn])) {
 					NewSub += "\n"
 					//替换影响机器翻译质量的 - 空格 符号
 					NewSub = strings.Replace(NewSub, "-", " ", -1)
 					NewSub = strings.Replace(NewSub, "  ", " ", -1)
 					NewSub = strings.Replace(NewSub, "  ", " ", -1)
 
-					_, werr := enfile.WriteString(NewSub)
-					checkError(werr)
+					if enfile != nil && cueTranslated(CurSub.Type) {
+						_, werr := enfile.WriteString(NewSub)
+						checkError(werr)
+					}
 
 					CurSub.DPos = NewCn
 					CurSub.MNum = mNum
 
 					if mNum >= nplinenum && len(pgfilepath) == 0 {
 						if !bnpline {
-							if slang == "en" {
-								fmt.Println("The lack of punctuation will greatly affect the subtitle translation effect.")
-							} else {
-								fmt.Println("缺少标点符号将极大影响字幕翻译效果，建议人工添加标点符号！")
-							}
+							printWarning("The lack of punctuation will greatly affect the subtitle translation effect.",
+								"缺少标点符号将极大影响字幕翻译效果，建议人工添加标点符号！")
 							bnpline = true
 						}
-						fmt.Println("BeginPos：" + strconv.Itoa(CurSub.SplitInfo[0].SPos) + " - EndPos：" +
-							strconv.Itoa(CurSub.SplitInfo[len(CurSub.SplitInfo)-1].SPos) + "  Rows:" + strconv.Itoa(mNum))
+						fmt.Fprintln(os.Stderr, "BeginPos："+strconv.Itoa(CurSub.SplitInfo[0].SPos)+" - EndPos："+
+							strconv.Itoa(CurSub.SplitInfo[len(CurSub.SplitInfo)-1].SPos)+"  Rows:"+strconv.Itoa(mNum))
 					}
 					CurSub.DESub = NewSub
+					keepCueText(&CurSub)
 					insub = append(insub, CurSub)
 					NewCn++
 					CurSub = subInfo{}
@@ -406,8 +807,9 @@ func oSubGentrText(inpath string) []subInfo {
 					mNum = 0
 				}
 
-				//fmt.Println(subText)
+				//fmt.Fprintln(os.Stderr, subText)
 				curpart = subpart{}
+				curtype = cuetypes[lineCn]
 				curpart.SPos = lineCn
 				lineCn++
 				continue
@@ -415,16 +817,49 @@ func oSubGentrText(inpath string) []subInfo {
 		}
 
 		//判断时间轴
-		timereg := regexp.MustCompile(`^\d*:\d*:\d*\d*:*,\d* --> \d*:\d*:\d*\d*:*,\d*$`)
-		if timereg.MatchString(subText) {
-			//fmt.Println(subText)
+		if subTimeReg.MatchString(subText) {
+			//fmt.Fprintln(os.Stderr, subText)
 			curpart.STime = subText
 			continue
 		}
+		//非对白的字幕：删除或单独成句
+		if len(curtype) > 0 {
+			if !cueBreaks(curtype) {
+				continue
+			}
+			CurSub.Type = curtype
+			if subText = cleanCueText(curtype, subText); len(subText) == 0 {
+				continue
+			}
+		}
+		//听障字幕：取出说话人及声音描述，只有声音描述的行不写入.en.txt
+		var linesdh sdhInfo
+		subText = extractSdh(subText, &linesdh)
+		if len(sdhmode) > 0 && len(subText) == 0 {
+			if len(linesdh.Speaker) > 0 || len(linesdh.Sounds) > 0 {
+				if (preTime == curpart.STime) && (BomLine >= 2) && len(CurSub.SplitInfo) > 0 {
+					last := &CurSub.SplitInfo[len(CurSub.SplitInfo)-1]
+					for k := range linesdh.Sounds {
+						linesdh.Sounds[k].After = len(last.SSub) > 0
+					}
+					addSdh(last, linesdh)
+				} else {
+					addSdh(&curpart, linesdh)
+					CurSub.SplitInfo = append(CurSub.SplitInfo, curpart)
+					mNum++
+					preTime = curpart.STime
+				}
+			}
+			continue
+		}
+		//恢复全大写或全小写原文的大小写
+		if truecaser != nil {
+			subText = truecaser.line(subText)
+		}
 		//判断行尾
 		reg := regexp.MustCompile(`([;\.\?!])\"*$`)
 		if reg.MatchString(subText) {
-			//fmt.Println("--" + subText)
+			//fmt.Fprintln(os.Stderr, "--" + subText)
 			NewSub += subText + " "
 			if (preTime == curpart.STime) && (BomLine >= 2) {
 				CurSub.SplitInfo[len(CurSub.SplitInfo)-1].SSub += " " + subText
@@ -461,8 +896,22 @@ func oSubGentrText(inpath string) []subInfo {
 			preTime = curpart.STime
 			lend = false
 		}
+		if len(sdhmode) > 0 {
+			last := &CurSub.SplitInfo[len(CurSub.SplitInfo)-1]
+			last.SSub = strings.TrimSpace(last.SSub)
+			addSdh(last, linesdh)
+		}
 
 	}
+	reportSdhMissing()
+
+	//结尾只有声音描述的行并入上一句
+	if len(strings.TrimSpace(NewSub)) == 0 && len(insub) > 0 {
+		prev := &insub[len(insub)-1]
+		prev.SplitInfo = append(prev.SplitInfo, CurSub.SplitInfo...)
+		prev.MNum = len(prev.SplitInfo)
+		return insub
+	}
 
 	NewSub += "\n"
 	//替换影响机器翻译质量的 - 符号
@@ -470,498 +919,530 @@ func oSubGentrText(inpath string) []subInfo {
 	NewSub = strings.Replace(NewSub, "  ", " ", -1)
 	NewSub = strings.Replace(NewSub, "  ", " ", -1)
 
-	_, werr := enfile.WriteString(NewSub)
-	checkError(werr)
+	if enfile != nil && cueTranslated(CurSub.Type) {
+		_, werr := enfile.WriteString(NewSub)
+		checkError(werr)
+	}
 
 	CurSub.DPos = NewCn
 	CurSub.MNum = mNum
 	CurSub.DESub = NewSub
+	keepCueText(&CurSub)
 	insub = append(insub, CurSub)
 	CurSub = subInfo{}
 	NewSub = ""
 	mNum = 0
 
-	os.Chmod(inpath+".en.txt", 0644)
 	return insub
 }
 
-func DetectFCharset(dfile string, ccF charCodes) charCodes {
-	trCode, chsErr := os.Open(dfile)
-	checkError(chsErr)
-	defer trCode.Close()
-
-	codeScanner := bufio.NewScanner(trCode)
-	alltext := ""
-	for codeScanner.Scan() {
-		alltext += codeScanner.Text() + "\n "
+//判断文件内容的字符集
+func DetectFCharset(data []byte) string {
+	if utf8.Valid(data) {
+		return "UTF-8"
 	}
-	ltext := []byte(alltext)
 	textDetector := chardet.NewTextDetector()
-	Result, _ := textDetector.DetectBest(ltext)
-	for a := 0; a < len(ccF)-1; a++ {
-		if strings.Compare(ccF[a].Name, Result.Charset) == 0 {
-			ccF[a].num = ccF[a].num + 1
-			//fmt.Println(tCA[a].Name + strconv.Itoa(tCA[a].num))
-			break
-		}
+	Result, derr := textDetector.DetectBest(data)
+	if derr != nil {
+		return "UTF-8"
 	}
-	sort.Sort(ccF)
-	return ccF
+	return Result.Charset
+}
+
+//默认的译文字幕文件名：Movie.srt -> Movie.chs.srt  Movie.mkv -> Movie.chs.srt
+func chsFileName(inpath string) string {
+	if strings.HasSuffix(strings.ToLower(inpath), ".srt") || isMkvFile(inpath) {
+		return inpath[0:strings.LastIndex(inpath, ".")] + ".chs.srt"
+	}
+	return inpath + ".txt"
 }
 
 func chstolastSub(chsallsub []subInfo) []subInfo {
 	trchsfilename := ""
-	chsfile, chsErr := os.Open(trfilepath)
+	//确定翻译文件字符集并转换为utf-8
+	chstext, chscharset, chsErr := readTextFile(trfilepath)
 	checkError(chsErr)
-	defer chsfile.Close()
 
-	if strings.HasSuffix(strings.ToLower(infilepath), ".srt") {
-		trchsfilename = infilepath[0:len(infilepath)-4] + ".chs.srt"
+	trchsfilename = chsFileName(infilepath)
+	//原文字幕或译文由标准输入读取时，默认输出到标准输出
+	if trfilepath == "-" {
+		trchsfilename = outFileName(trfilepath, trchsfilename, langTag(tglang), typeSrt)
 	} else {
-		trchsfilename = infilepath + ".txt"
+		trchsfilename = outFileName(infilepath, trchsfilename, langTag(tglang), typeSrt)
 	}
 
-	del_file(trchsfilename)
-
-	subfile, enErr := os.OpenFile(trchsfilename, os.O_CREATE|os.O_WRONLY, os.ModeAppend)
-	checkError(enErr)
+	subfile, enErr := openSubFile(trchsfilename)
+	checkOutput(enErr)
 	defer subfile.Close()
-	// 载入词典
-	var segmenter sego.Segmenter
-	segmenter.LoadDictionary("dictionary.txt")
-
-	//确定翻译文件字符集
-	var tCA charCodes
-	tCA = []charCode{{"UTF8", 0}, {"GB18030", 0}, {"BIG5", 0}}
+	// 按原文及译文语言确定分词方式
+	srcseg := langSegmenter(srclang)
+	tgseg := langSegmenter(tglang)
 
-	tCA = DetectFCharset(trfilepath, tCA)
 	if slang == "en" {
-		fmt.Println("Determine the character set：" + tCA[0].Name + "\n")
+		fmt.Fprintln(os.Stderr, "Determine the character set："+chscharset+"\n")
 
 	} else {
-		fmt.Println("确定翻译文件的字符集为：" + tCA[0].Name + "\n")
+		fmt.Fprintln(os.Stderr, "确定翻译文件的字符集为："+chscharset+"\n")
 	}
 
 	//开始合并翻译文件
 	//增加传播字幕行，让更多人受益。
-	jsfirstxt := "1" + "\n" +
-		"00:00:00,000 --> 00:00:05,000" + "\n" +
-		"{\\pos(200,210)}由机翻双语字幕辅助软件直接生成，此字幕仅用于研究学习" + "\n" +
-		"url：github.com/jikaimail/SubtitleTranslation/" + "\n"
-	_, suberr := subfile.WriteString(jsfirstxt)
+	_, suberr := subfile.WriteString(jsfirstext)
 	checkError(suberr)
 
-	chsScanner := bufio.NewScanner(chsfile)
+	chsScanner := bufio.NewScanner(bytes.NewReader(chstext))
 	lCount := 0
 
-	for chsScanner.Scan() {
-		//去掉utf8 BOM标志
-		bomtext := ""
-		if lCount == 0 {
-			bomtext = strings.Replace(chsScanner.Text(), "\uFEFF", "", 1)
-
-		} else {
-			bomtext = chsScanner.Text()
-		}
-		temptext := []byte(bomtext)
-		switch tCA[0].Name {
-		case "GB18030":
-			stem, _ := DecodeGBK(temptext)
-			chsallsub[lCount].DCSub = string(stem)
-		case "UTF8":
-			chsallsub[lCount].DCSub = chsScanner.Text()
-		case "BIG5":
-			stem, _ := DecodeBig5(temptext)
-			chsallsub[lCount].DCSub = string(stem)
-		default:
-			chsallsub[lCount].DCSub = chsScanner.Text()
+	//保留原文的字幕不在翻译文件中
+	writeKept := func() {
+		for lCount < len(chsallsub) && !cueTranslated(chsallsub[lCount].Type) {
+			for i := range chsallsub[lCount].SplitInfo {
+				_, werr := subfile.WriteString(subPartText(chsallsub[lCount], chsallsub[lCount].SplitInfo[i]))
+				checkError(werr)
+			}
+			lCount++
 		}
-		var subtext string
+	}
+
+	for chsScanner.Scan() {
+		writeKept()
+		chsallsub[lCount].DCSub = chsScanner.Text()
 
 		//将每句翻译，切分为若干行
-		if chsallsub[lCount].MNum > 1 {
-			lastEnSub := chsallsub[lCount].DESub
-			//替换（,）为（，）,同时处理数字的，逗号问题。
-			lastSub := strings.Replace(chsallsub[lCount].DCSub, ",", "，", -1)
-			lastSub = strings.Replace(lastSub, "  ", " ", -1)
-			lastSub = strings.Replace(lastSub, "  ", " ", -1)
-			lastSub = strings.Replace(lastSub, "  ", " ", -1)
-			lastSub = strings.Replace(lastSub, "  ", " ", -1)
-
-			lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
-			lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
-			lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
-			lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
-
-			regdig := regexp.MustCompile(`[0-9]+[，][0-9]+`)
-			regdigf := func(s string) string {
-				return strings.Replace(s, "，", ",", -1)
+		splitSubLine(srcseg, tgseg, &chsallsub[lCount])
+		if chsallsub[lCount].MNum > 0 {
+			for i := range chsallsub[lCount].SplitInfo {
+				_, werr := subfile.WriteString(subPartText(chsallsub[lCount], chsallsub[lCount].SplitInfo[i]))
+				checkError(werr)
 			}
-			digfstr := regdig.ReplaceAllStringFunc(lastSub, regdigf)
-			lastSub = digfstr
+		}
+		lCount++
+	}
+	writeKept()
+	checkError(subfile.Close())
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "A subtitle file has been generated .")
+		fmt.Fprintln(os.Stderr, "Please check the file: "+trchsfilename+" ."+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "生成所需的字幕文件.")
+		fmt.Fprintln(os.Stderr, "请查看文件: "+trchsfilename+" ."+"\n")
+	}
+	checkOutput(convAfterMerge(trchsfilename, infilepath))
+	return chsallsub
+}
 
-			regSplit := regexp.MustCompile(`,$`)
-			preSplit := true
-			var enlen, chsLen int
+//将一句译文按原文的行切分规则，切分到各行字幕中
+//srcseg 为原文分词方式，tgseg 为译文分词方式
+func splitSubLine(srcseg, tgseg Segmenter, cursub *subInfo) {
+	if splitDialogueLines(srcseg, tgseg, cursub) {
+		return
+	}
+	//将每句翻译，切分为若干行
+	if cursub.MNum > 1 {
+		lastEnSub := cursub.DESub
+		//替换（,）为（，）,同时处理数字的，逗号问题。
+		lastSub := strings.Replace(cursub.DCSub, ",", "，", -1)
+		lastSub = strings.Replace(lastSub, "  ", " ", -1)
+		lastSub = strings.Replace(lastSub, "  ", " ", -1)
+		lastSub = strings.Replace(lastSub, "  ", " ", -1)
+		lastSub = strings.Replace(lastSub, "  ", " ", -1)
+
+		lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
+		lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
+		lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
+		lastEnSub = strings.Replace(lastEnSub, "  ", " ", -1)
+
+		regdig := regexp.MustCompile(`[0-9]+[，][0-9]+`)
+		regdigf := func(s string) string {
+			return strings.Replace(s, "，", ",", -1)
+		}
+		digfstr := regdig.ReplaceAllStringFunc(lastSub, regdigf)
+		lastSub = digfstr
 
-			for i := range chsallsub[lCount].SplitInfo {
-				var subchs string
-				subchs = ""
-				//fmt.Println(strconv.Itoa(i) + ":" + strconv.Itoa(chsallsub[lCount].MNum))
+		regSplit := regexp.MustCompile(`,$`)
+		preSplit := true
+		var enlen, chsLen int
 
-				//当仅一行或多行时的最后一行 则直接赋值
-				if i == chsallsub[lCount].MNum-1 {
-					subchs = lastSub
-				} else {
-					//切分行数大于1时
-					bsplit := regSplit.MatchString(chsallsub[lCount].SplitInfo[i].SSub)
-					sEn := strings.Split(chsallsub[lCount].SplitInfo[i].SSub, ",")
-					sChs := strings.Split(lastSub, "，")
-
-					//有逗号结尾分隔符切分
-					if (len(sChs) >= len(sEn)) && bsplit && preSplit {
-						for j := range sEn {
-							juNum := len(lastSub) / chsallsub[lCount].MNum
-							if j == len(sEn)-1 {
-								//处理译文多出一个逗号的特殊情况
-
-								if (len(sChs) > len(sEn)) &&
-									(!(len(sChs) == chsallsub[lCount].MNum-1)) &&
-									(len(subchs) < (juNum - juNum/3)) {
-									nextNum := len(subchs + sChs[j])
-									if nextNum < (juNum+juNum/3) &&
-										(j < len(sChs)-1) {
-										subchs += sChs[j]
-										subchs += "，"
-									}
+		for i := range cursub.SplitInfo {
+			var subchs string
+			subchs = ""
+			//fmt.Fprintln(os.Stderr, strconv.Itoa(i) + ":" + strconv.Itoa(cursub.MNum))
+
+			//当仅一行或多行时的最后一行 则直接赋值
+			if i == cursub.MNum-1 {
+				subchs = lastSub
+			} else {
+				//切分行数大于1时
+				bsplit := regSplit.MatchString(cursub.SplitInfo[i].SSub)
+				sEn := strings.Split(cursub.SplitInfo[i].SSub, ",")
+				sChs := strings.Split(lastSub, "，")
+
+				//有逗号结尾分隔符切分
+				if (len(sChs) >= len(sEn)) && bsplit && preSplit {
+					for j := range sEn {
+						juNum := len(lastSub) / cursub.MNum
+						if j == len(sEn)-1 {
+							//处理译文多出一个逗号的特殊情况
+
+							if (len(sChs) > len(sEn)) &&
+								(!(len(sChs) == cursub.MNum-1)) &&
+								(len(subchs) < (juNum - juNum/3)) {
+								nextNum := len(subchs + sChs[j])
+								if nextNum < (juNum+juNum/3) &&
+									(j < len(sChs)-1) {
+									subchs += sChs[j]
+									subchs += "，"
 								}
+							}
+							break
+						} else {
+							if len(subchs+sChs[j]) > (juNum+juNum/3) &&
+								len(subchs) > 0 {
 								break
-							} else {
-								if len(subchs+sChs[j]) > (juNum+juNum/3) &&
-									len(subchs) > 0 {
-									break
-								}
 							}
-							subchs += sChs[j]
-							subchs += "，"
 						}
-						preSplit = true
-					} else {
-						//无逗号结尾分隔符切分
-
-						//获取剩余英文总长度
-						textten := []byte(lastEnSub)
-						segments2 := segmenter.Segment(textten)
-						strtxt2 := sego.SegmentsToSlice(segments2, false)
-						iennum := 0
-						for ic := range strtxt2 {
-							if !(strings.Compare(strtxt2[ic], " ") == 0) {
-								iennum += 1
-							}
+						subchs += sChs[j]
+						subchs += "，"
+					}
+					preSplit = true
+				} else {
+					//无逗号结尾分隔符切分
+
+					//获取剩余英文总长度
+					strtxt2 := srcseg.Segment(lastEnSub)
+					iennum := 0
+					for ic := range strtxt2 {
+						if !(strings.Compare(strtxt2[ic], " ") == 0) {
+							iennum += 1
 						}
-						enlen = iennum
-
-						//获取当前行英文长度
-						textten1 := []byte(chsallsub[lCount].SplitInfo[i].SSub)
-						segments3 := segmenter.Segment(textten1)
-						strtxt1 := sego.SegmentsToSlice(segments3, false)
-						lennum := 0
-						for ib := range strtxt1 {
-							if !(strings.Compare(strtxt1[ib], " ") == 0) {
-								lennum += 1
-							}
+					}
+					enlen = iennum
+
+					//获取当前行英文长度
+					strtxt1 := srcseg.Segment(cursub.SplitInfo[i].SSub)
+					lennum := 0
+					for ib := range strtxt1 {
+						if !(strings.Compare(strtxt1[ib], " ") == 0) {
+							lennum += 1
 						}
-						var linlen float64
-						linlen = float64(lennum)
-
-						//获取剩余中文的长度
-						text1 := []byte(lastSub)
-						segments1 := segmenter.Segment(text1)
-						strtxt := sego.SegmentsToSlice(segments1, false)
-						chsnum := 0
-						for ia := range strtxt {
-							if !(strings.Compare(strtxt[ia], " ") == 0) {
-								chsnum += 1
-							}
+					}
+					var linlen float64
+					linlen = float64(lennum)
+
+					//获取剩余中文的长度
+					strtxt := tgseg.Segment(lastSub)
+					chsnum := 0
+					for ia := range strtxt {
+						if !(strings.Compare(strtxt[ia], " ") == 0) {
+							chsnum += 1
 						}
-						chsLen = chsnum
-
-						preSplit = false
-						text := []byte(lastSub)
-						segments := segmenter.Segment(text)
-						CText := sego.SegmentsToSlice(segments, false)
-						var nextpos, avgLen float64
-						avgLen = float64(linlen) / float64(enlen) * float64(chsLen)
-						nextpos = 0
-						lsub := ""
-						presub := ""
-
-						for k := range CText {
-							lsub = ""
-							avgline := float64(avgLen / 3)
-							if ((nextpos - avgLen) >= 0) && (!ContainSym(CText[k])) {
-								var lpos float64
-								lpos = 0
-								for j := k; j < len(CText)-1; j++ {
-									if (lpos <= avgline) && (j < len(CText)-2) {
-										if ContainSym(CText[j]) {
-											lsub += CText[j]
-											subchs += lsub
-											lsub = ""
-											break
-										}
+					}
+					chsLen = chsnum
+
+					preSplit = false
+					CText := tgseg.Segment(lastSub)
+					var nextpos, avgLen float64
+					avgLen = float64(linlen) / float64(enlen) * float64(chsLen)
+					nextpos = 0
+					lsub := ""
+					presub := ""
+
+					for k := range CText {
+						lsub = ""
+						avgline := float64(avgLen / 3)
+						if ((nextpos - avgLen) >= 0) && (!ContainSym(CText[k])) {
+							var lpos float64
+							lpos = 0
+							for j := k; j < len(CText)-1; j++ {
+								if (lpos <= avgline) && (j < len(CText)-2) {
+									if ContainSym(CText[j]) {
 										lsub += CText[j]
-										if !(strings.Compare(CText[j], " ") == 0) {
-											lpos += 1
-										}
-										continue
-									} else {
-										if len(presub) > 0 {
-											subchs = presub
-										} else {
-											lsub = ""
-										}
+										subchs += lsub
+										lsub = ""
 										break
 									}
+									lsub += CText[j]
+									if !(strings.Compare(CText[j], " ") == 0) {
+										lpos += 1
+									}
+									continue
+								} else {
+									if len(presub) > 0 {
+										subchs = presub
+									} else {
+										lsub = ""
+									}
+									break
 								}
-								break
 							}
+							break
+						}
 
-							brnum := (len(chsallsub[lCount].SplitInfo) - i - 1) * 2
-							if k < (len(CText) - brnum) {
-								subchs += CText[k]
-							} else {
-								break
-							}
+						brnum := (len(cursub.SplitInfo) - i - 1) * 2
+						if k < (len(CText) - brnum) {
+							subchs += CText[k]
+						} else {
+							break
+						}
 
-							if !(strings.Compare(CText[k], " ") == 0) {
-								nextpos += 1
-							}
-							if ContainSym(CText[k]) && ((avgLen - nextpos) <= avgline) {
-								presub = subchs
-							}
+						if !(strings.Compare(CText[k], " ") == 0) {
+							nextpos += 1
+						}
+						if ContainSym(CText[k]) && ((avgLen - nextpos) <= avgline) {
+							presub = subchs
 						}
 					}
 				}
-				chsallsub[lCount].SplitInfo[i].SCSub = subchs
-				lastEnSub = lastEnSub[len(chsallsub[lCount].SplitInfo[i].SSub):len(lastEnSub)]
-				lastSub = lastSub[len(subchs):len(lastSub)]
-				if sstype == "b" {
-					subtext = strconv.Itoa(chsallsub[lCount].SplitInfo[i].SPos+1) + "\n" +
-						chsallsub[lCount].SplitInfo[i].STime + "\n" +
-						chsallsub[lCount].SplitInfo[i].SCSub + "\n" +
-						chsallsub[lCount].SplitInfo[i].SSub + "\n"
-				} else {
-					subtext = strconv.Itoa(chsallsub[lCount].SplitInfo[i].SPos+1) + "\n" +
-						chsallsub[lCount].SplitInfo[i].STime + "\n" +
-						chsallsub[lCount].SplitInfo[i].SCSub + "\n"
-				}
-				//fmt.Println(subtext)
-				//fmt.Println("POS:" + strconv.Itoa(chsallsub[lCount].DPos))
-				_, werr := subfile.WriteString(subtext)
-				checkError(werr)
 			}
+			cursub.SplitInfo[i].SCSub = subchs
+			lastEnSub = lastEnSub[len(cursub.SplitInfo[i].SSub):len(lastEnSub)]
+			lastSub = lastSub[len(subchs):len(lastSub)]
+		}
 
-		} else {
-			if chsallsub[lCount].MNum == 1 {
-				chsallsub[lCount].SplitInfo[0].SCSub = chsallsub[lCount].DCSub
-				if sstype == "b" {
-					subtext = strconv.Itoa(chsallsub[lCount].SplitInfo[0].SPos+1) + "\n" +
-						chsallsub[lCount].SplitInfo[0].STime + "\n" +
-						chsallsub[lCount].DCSub + "\n" +
-						chsallsub[lCount].SplitInfo[0].SSub + "\n"
-				} else {
-					subtext = strconv.Itoa(chsallsub[lCount].SplitInfo[0].SPos+1) + "\n" +
-						chsallsub[lCount].SplitInfo[0].STime + "\n" +
-						chsallsub[lCount].DCSub + "\n"
-				}
-				//fmt.Println(subtext)
-				//fmt.Println("POS:" + strconv.Itoa(chsallsub[lCount].DPos))
-				_, werr := subfile.WriteString(subtext)
-				checkError(werr)
+	} else {
+		if cursub.MNum == 1 {
+			cursub.SplitInfo[0].SCSub = cursub.DCSub
+		}
+	}
+	cursub.DCHash = subHash(cursub.DCSub)
+}
 
-			}
+//译文内容的摘要，用于判断译文是否被修改过
+func subHash(text string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(text)))
+}
+
+//根据json 文件直接生成双语字幕
+func jsonSubText(subs []subInfo) string {
+	var b strings.Builder
+	//增加传播字幕行，让更多人受益。
+	b.WriteString(jsfirstext)
+	for jspos := range subs {
+		for spos := range subs[jspos].SplitInfo {
+			b.WriteString(subPartText(subs[jspos], subs[jspos].SplitInfo[spos]))
 		}
-		lCount++
 	}
-	if slang == "en" {
-		fmt.Println("A subtitle file has been generated .")
-		fmt.Println("Please check the file: " + trchsfilename + " ." + "\n")
-	} else {
-		fmt.Println("生成所需的字幕文件.")
-		fmt.Println("请查看文件: " + trchsfilename + " ." + "\n")
+	return b.String()
+}
+
+//生成一条字幕的srt文本
+func subPartText(sub subInfo, part subpart) string {
+	//保留原文的字幕双语时也只显示一次
+	if sstype == "b" && cueTranslated(sub.Type) {
+		return strconv.Itoa(part.SPos+1) + "\n" +
+			part.STime + "\n" +
+			cueStyle(sub.Type, sdhText(part.SDH, part.SCSub, true), true) + "\n" +
+			cueStyle(sub.Type, sdhText(part.SDH, part.SSub, false), false) + "\n"
 	}
-	os.Chmod(trchsfilename, 0644)
-	return chsallsub
+	return strconv.Itoa(part.SPos+1) + "\n" +
+		part.STime + "\n" +
+		cueStyle(sub.Type, sdhText(part.SDH, part.SCSub, true), true) + "\n"
 }
 
 func oSubAddPunctuator(oSubinfo []subInfo) {
-	var segmenter sego.Segmenter
-	segmenter.LoadDictionary("dictionary.txt")
-	del_file(pgfilepath + ".en.srt")
-
-	pgfile, enErr := os.OpenFile(pgfilepath+".en.srt", os.O_CREATE|os.O_WRONLY, os.ModeAppend)
-	checkError(enErr)
+	punctuator := newPunctuator()
+	segmenter := langSegmenter(srclang)
+	pgsrtfilename := outFileName(pgfilepath, pgfilepath+".en.srt", langTag(srclang), typeSrt)
+	pgfile, enErr := openSubFile(pgsrtfilename)
+	checkOutput(enErr)
 	defer pgfile.Close()
 	subtext := ""
 
-	if slang == "en" {
-		fmt.Println("Punctuation is being accessed at http://bark.phon.ioc.ee/punctuator." + "\n")
-	} else {
-		fmt.Println("正在访问http://bark.phon.ioc.ee/punctuator获取标点符号。" + "\n")
-	}
+	var failed []string
+	capstart := true
 
 	for ia := range oSubinfo {
 
-		resp, _ := http.PostForm("http://bark.phon.ioc.ee/punctuator",
-			url.Values{"text": {oSubinfo[ia].DESub}})
-		defer resp.Body.Close()
-
-		body, _ := ioutil.ReadAll(resp.Body)
-
-		segments1 := segmenter.Segment(body)
-		pgText := sego.SegmentsToSlice(segments1, false)
-
-		lcn := 0
+		//歌词、屏幕文字等非对白字幕不是完整的句子，不添加标点
+		body := oSubinfo[ia].DESub
+		if len(oSubinfo[ia].Type) == 0 {
+			var perr error
+			if body, perr = punctuator.Punctuate(oSubinfo[ia].DESub); perr != nil {
+				punctFailure(oSubinfo[ia].DPos, perr)
+				failed = append(failed, strconv.Itoa(oSubinfo[ia].DPos))
+				body = oSubinfo[ia].DESub
+			}
+		}
 
+		//按对齐结果将标点转移到各行原文
+		var lines []string
 		for ib := range oSubinfo[ia].SplitInfo {
-			ensubtext := []byte(oSubinfo[ia].SplitInfo[ib].SSub)
-			segments1 := segmenter.Segment(ensubtext)
-			lsubText := sego.SegmentsToSlice(segments1, false)
-			lastText := ""
-			for ic := range lsubText {
-
-				if lsubText[ic] == " " {
-					continue
-				}
-				if lsubText[ic] == "'" {
-					//lastText = lastText[0 : len(lastText)-1]
-					lastText = strings.TrimRight(lastText, " ")
-					lastText += lsubText[ic]
-				} else {
-					lastText += lsubText[ic] + " "
-				}
-				for id := lcn; id < len(pgText)-1; id++ {
-					lcn = id
-
-					if pgText[id] == " " ||
-						pgText[id] == lsubText[ic] {
-						continue
-					}
+			lines = append(lines, oSubinfo[ia].SplitInfo[ib].SSub)
+		}
+		punctlines := transferPunct(segmenter, body, lines)
 
-					if containEndSym(pgText[id]) {
-						lastText = strings.TrimRight(lastText, " ")
-						lastText += pgText[id] + " "
-					} else {
-						break
-					}
-				}
+		for ib := range oSubinfo[ia].SplitInfo {
+			lastText := punctlines[ib]
+			if btruecase {
+				lastText, capstart = capitalizeSentences(lastText, capstart)
 			}
-			lastText = strings.TrimRight(lastText, " ")
-			lastText = strings.TrimRight(lastText, " ")
 
 			subtext = strconv.Itoa(oSubinfo[ia].SplitInfo[ib].SPos) + "\n" +
 				oSubinfo[ia].SplitInfo[ib].STime + "\n" +
-				lastText + "\n"
+				cueStyle(oSubinfo[ia].Type, sdhText(oSubinfo[ia].SplitInfo[ib].SDH, lastText, false), true) + "\n"
 			_, werr := pgfile.WriteString(subtext)
 			checkError(werr)
 		}
 	}
-	os.Chmod(pgfilepath+".en.srt", 0644)
+	reportPunctFailures(failed)
 	if slang == "en" {
-		fmt.Println("Generate a subtitle file with punctuation added .")
-		fmt.Println("Please check the file: " + pgfilepath + ".en.srt" + " ." + "\n")
+		fmt.Fprintln(os.Stderr, "Generate a subtitle file with punctuation added .")
+		fmt.Fprintln(os.Stderr, "Please check the file: "+pgsrtfilename+" ."+"\n")
 	} else {
-		fmt.Println("生成带添加标点符号的字幕文件.")
-		fmt.Println("请查看文件: " + pgfilepath + ".en.srt" + " ." + "\n")
+		fmt.Fprintln(os.Stderr, "生成带添加标点符号的字幕文件.")
+		fmt.Fprintln(os.Stderr, "请查看文件: "+pgsrtfilename+" ."+"\n")
 	}
 }
 
 func main() {
 	flag.Parse()
 
-	if h || (infilepath == "" && josnfilepath == "" && len(pgfilepath) == 0) {
+	if h || (infilepath == "" && josnfilepath == "" && len(pgfilepath) == 0 && len(convfilepath) == 0 &&
+		len(batchpaths) == 0 && len(watchdir) == 0 && len(ptrainpaths) == 0) {
 		flag.Usage()
 		os.Exit(0)
 	}
+	checkOutEncoding()
+	checkSdhMode()
+	loadCuePolicies()
+
 	var allsub []subInfo
 
+	//监视目录，自动完成各处理步骤
+	if len(watchdir) > 0 {
+		WatchFolder()
+	}
+
+	//批量处理目录内的字幕文件
+	if len(batchpaths) > 0 {
+		BatchSub()
+		os.Exit(0)
+	}
+
+	//训练离线标点模型
+	if len(ptrainpaths) > 0 {
+		TrainPunctModel()
+		os.Exit(exitCode())
+	}
+
 	//为原字幕文件添加标点符号
 	if len(pgfilepath) > 0 {
-		allsub = oSubGentrText(pgfilepath)
-		del_file(pgfilepath + ".en.txt")
+		allsub = oSubGentrText(pgfilepath, "")
 		oSubAddPunctuator(allsub)
-		os.Exit(0)
+		os.Exit(exitCode())
+	}
+
+	//简繁转换已有的字幕或json文件
+	if len(convfilepath) > 0 {
+		ConvSubFile()
+		os.Exit(exitCode())
 	}
 
 	//由辅助json文件直接生成双语字幕
 	if len(josnfilepath) > 0 {
-		JsonGenSub()
-		os.Exit(0)
+		if len(diffpath) > 0 {
+			DiffProjects()
+		} else if len(mergepath) > 0 {
+			MergeProjects()
+		} else if breview {
+			ReviewProject()
+		} else if bserve {
+			ServeProject()
+		} else if blistcomments {
+			ListComments()
+		} else if len(setstatus) > 0 || len(assignee) > 0 || len(commenttext) > 0 || bresolve {
+			UpdateWorkflow()
+		} else if len(exportpath) > 0 {
+			ExportProject()
+		} else if len(importpath) > 0 {
+			ImportProject()
+		} else if bresplit {
+			JsonResplitSub()
+		} else {
+			JsonGenSub()
+		}
+		os.Exit(exitCode())
 	}
 
 	//转换原文字幕为待翻译文件
 	_, lerr := os.Stat(infilepath)
-	if os.IsNotExist(lerr) {
+	if infilepath != "-" && os.IsNotExist(lerr) {
 		if slang == "en" {
-			fmt.Print("No subtitle files found:" + infilepath + "\n")
-			fmt.Print("-infile filename (Requires plain srt subtitle file)" + "\n")
+			fmt.Fprint(os.Stderr, "No subtitle files found:"+infilepath+"\n")
+			fmt.Fprint(os.Stderr, "-infile filename (Requires plain srt subtitle file)"+"\n")
 		} else {
-			fmt.Print("未发现字幕文件:" + infilepath + "\n")
-			fmt.Print("-infile 字幕文件名 (需要无格式的srt字幕文件)" + "\n")
+			fmt.Fprint(os.Stderr, "未发现字幕文件:"+infilepath+"\n")
+			fmt.Fprint(os.Stderr, "-infile 字幕文件名 (需要无格式的srt字幕文件)"+"\n")
 		}
+		os.Exit(1)
+	}
+
+	//列出Matroska文件中的字幕轨道
+	if blisttracks {
+		ListMkvTracks(infilepath)
 		os.Exit(0)
 	}
 
-	allsub = oSubGentrText(infilepath)
+	//辅助json文件名
+	jsonfilename := ""
+	if len(jsoutpath) > 0 {
+		jsonfilename = jsoutpath
+	} else if infilepath != "-" {
+		jsonfilename = templateName(infilepath, infilepath+".json", langTag(srclang), typeJson)
+	}
+	checkOutput(checkJsonOverwrite(jsonfilename))
 
 	if len(trfilepath) == 0 {
+		enfilename := outFileName(infilepath, infilepath+".en.txt", langTag(srclang), typeTxt)
+		allsub = oSubGentrText(infilepath, enfilename)
 		if slang == "en" {
-			fmt.Println("Please translate the file [" + infilepath + ".en.txt]  ")
-			fmt.Println("Translate URLs: https://translate.google.com/")
-			fmt.Println("             or https://cn.bing.com/Translator")
-			fmt.Println("             or https://fanyi.baidu.com")
-			fmt.Println("Chrome can drag and drop files directly onto the above website pages,  ")
-			fmt.Println("  and Google Translate can generate translations directly.")
-			fmt.Println("Note: Make sure the translated content matches the line location ")
-			fmt.Println("      and total number of rows of the original content." + "\n")
+			fmt.Fprintln(os.Stderr, "Please translate the file ["+enfilename+"]  ")
+			fmt.Fprintln(os.Stderr, "Translate URLs: https://translate.google.com/")
+			fmt.Fprintln(os.Stderr, "             or https://cn.bing.com/Translator")
+			fmt.Fprintln(os.Stderr, "             or https://fanyi.baidu.com")
+			fmt.Fprintln(os.Stderr, "Chrome can drag and drop files directly onto the above website pages,  ")
+			fmt.Fprintln(os.Stderr, "  and Google Translate can generate translations directly.")
+			fmt.Fprintln(os.Stderr, "Note: Make sure the translated content matches the line location ")
+			fmt.Fprint(os.Stderr, "      and total number of rows of the original content."+"\n\n")
 		} else {
-			fmt.Println("请翻译此文件 [" + infilepath + ".en.txt]  ")
-			fmt.Println("可选用以下网址进行翻译： ")
-			fmt.Println(" URLs: https://translate.google.com")
-			fmt.Println("    or https://cn.bing.com/Translator")
-			fmt.Println("    or https://fanyi.baidu.com")
-			fmt.Println("Chrome可将文件直接拖拽到以上网站页面，谷歌翻译即可生成翻译内容。")
-			fmt.Println("注意事项：确保翻译内容与原内容的行位置和总行数要匹配。" + "\n")
+			fmt.Fprintln(os.Stderr, "请翻译此文件 ["+enfilename+"]  ")
+			fmt.Fprintln(os.Stderr, "可选用以下网址进行翻译： ")
+			fmt.Fprintln(os.Stderr, " URLs: https://translate.google.com")
+			fmt.Fprintln(os.Stderr, "    or https://cn.bing.com/Translator")
+			fmt.Fprintln(os.Stderr, "    or https://fanyi.baidu.com")
+			fmt.Fprintln(os.Stderr, "Chrome可将文件直接拖拽到以上网站页面，谷歌翻译即可生成翻译内容。")
+			fmt.Fprint(os.Stderr, "注意事项：确保翻译内容与原内容的行位置和总行数要匹配。"+"\n\n")
 		}
 
 		//生成辅助json文件
-		del_file(infilepath + ".json")
-		jfilein, _ := json.MarshalIndent(allsub, "", "\t")
-		_ = ioutil.WriteFile(infilepath+".json", jfilein, 0644)
+		if len(jsonfilename) > 0 {
+			saveProject(jsonfilename, newProject(infilepath, allsub))
+		}
 
-		os.Exit(0)
+		os.Exit(exitCode())
 	}
 
+	allsub = oSubGentrText(infilepath, "")
+
 	//处理并合并翻译文件
 	_, eErr := os.Stat(trfilepath)
-	if !os.IsNotExist(eErr) {
+	if trfilepath == "-" || !os.IsNotExist(eErr) {
 
 		allsub = chstolastSub(allsub)
 	} else {
 		if slang == "en" {
-			fmt.Println("The translated subtitle file was not found." + "\n")
-			fmt.Println("Please check if the file path and file name are correct." + "\n")
-			fmt.Println("TrSubtitle -h Get help." + "\n")
+			fmt.Fprint(os.Stderr, "The translated subtitle file was not found."+"\n\n")
+			fmt.Fprint(os.Stderr, "Please check if the file path and file name are correct."+"\n\n")
+			fmt.Fprint(os.Stderr, "TrSubtitle -h Get help."+"\n\n")
 		} else {
-			fmt.Println("未发现已翻译的字幕文件，请核对文件路径及文件名是否正确。" + "\n")
-			fmt.Println("TrSubtitle -h 获取帮助。" + "\n")
+			fmt.Fprint(os.Stderr, "未发现已翻译的字幕文件，请核对文件路径及文件名是否正确。"+"\n\n")
+			fmt.Fprint(os.Stderr, "TrSubtitle -h 获取帮助。"+"\n\n")
 		}
 	}
 
 	//生成辅助json文件
-	del_file(infilepath + ".json")
-	jlastfile, _ := json.MarshalIndent(allsub, "", "\t")
-	_ = ioutil.WriteFile(infilepath+".json", jlastfile, 0644)
-
+	if len(jsonfilename) > 0 {
+		saveProject(jsonfilename, newProject(infilepath, allsub))
+	}
+	os.Exit(exitCode())
 }
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+//批量处理时，子进程通过此环境变量返回警告状态
+const (
+	batchEnv        = "TRSUBTITLE_BATCH"
+	batchWarnExit   = 3
+	batchWarnPrefix = "WARN: "
+)
+
+//警告信息数量及第一条警告信息
+var (
+	warnCount int
+	firstWarn string
+)
+
+//按 -lang 参数输出警告信息并记录
+func printWarning(enmsg, chsmsg string) {
+	msg := chsmsg
+	if slang == "en" {
+		msg = enmsg
+	}
+	fmt.Fprintln(os.Stderr, msg)
+	warnCount++
+	if len(firstWarn) == 0 {
+		firstWarn = strings.TrimSuffix(msg, ":")
+	}
+}
+
+//处理结束时的退出码，批量处理的子进程有警告时返回 batchWarnExit，
+//并在最后输出第一条警告信息供汇总表使用
+func exitCode() int {
+	if warnCount > 0 && len(os.Getenv(batchEnv)) > 0 {
+		fmt.Fprintln(os.Stderr, batchWarnPrefix+firstWarn)
+		return batchWarnExit
+	}
+	return 0
+}
+
+//译文文件的命名规则，依次查找：Movie.srt.chs.txt Movie.srt.zh.txt Movie.chs.txt Movie.zh.txt
+var batchTrSuffixes = []string{".srt.chs.txt", ".srt.zh.txt", ".chs.txt", ".zh.txt"}
+
+//不传递给子进程的参数
+var batchOwnFlags = map[string]bool{
+	"batch": true, "r": true, "workers": true, "watch": true, "interval": true, "h": true,
+	"infile": true, "trfile": true, "jsfile": true, "pfile": true, "convfile": true,
+	"o": true, "jsout": true, "resplit": true,
+}
+
+type batchJob struct {
+	srtpath string
+	trpath  string
+	jspath  string
+	action  string
+	outpath string
+	status  string
+	message string
+}
+
+//批量处理目录或通配符匹配的字幕文件
+func BatchSub() {
+	srtfiles := batchFiles(batchpaths)
+	if len(srtfiles) == 0 {
+		if slang == "en" {
+			fmt.Fprint(os.Stderr, "No srt subtitle files found:"+batchpaths+"\n")
+		} else {
+			fmt.Fprint(os.Stderr, "未发现srt字幕文件:"+batchpaths+"\n")
+		}
+		os.Exit(1)
+	}
+
+	exepath, args := batchChildArgs()
+
+	jobs := make([]*batchJob, len(srtfiles))
+	for i, srtpath := range srtfiles {
+		jobs[i] = newBatchJob(srtpath, !bforce)
+	}
+
+	workers := nworkers
+	if workers < 1 {
+		workers = 1
+	}
+	jobch := make(chan *batchJob)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobch {
+				runBatchJob(exepath, args, job)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if len(job.status) == 0 {
+			jobch <- job
+		}
+	}
+	close(jobch)
+	wg.Wait()
+
+	printBatchSummary(jobs)
+	//有处理失败的文件时以非零退出码结束
+	for _, job := range jobs {
+		if job.status == "FAIL" {
+			os.Exit(1)
+		}
+	}
+}
+
+//子进程的程序名及公共参数
+func batchChildArgs() (string, []string) {
+	exepath, eerr := os.Executable()
+	checkError(eerr)
+
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if !batchOwnFlags[f.Name] {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return exepath, args
+}
+
+//确定每个字幕文件的处理方式：有译文时合并生成字幕，否则生成待译原文
+//skipDone 为 true 时跳过已生成的文件
+func newBatchJob(srtpath string, skipDone bool) *batchJob {
+	job := &batchJob{srtpath: srtpath}
+	job.jspath = templateName(srtpath, srtpath+".json", langTag(srclang), typeJson)
+	base := srtpath[0 : len(srtpath)-len(filepath.Ext(srtpath))]
+	for _, suffix := range batchTrSuffixes {
+		trpath := base + suffix
+		if strings.HasPrefix(suffix, ".srt") {
+			trpath = srtpath + suffix[4:]
+		}
+		if _, serr := os.Stat(trpath); serr == nil {
+			job.trpath = trpath
+			break
+		}
+	}
+
+	if len(job.trpath) > 0 {
+		job.action = "merge"
+		job.outpath = templateName(srtpath, chsFileName(srtpath), langTag(tglang), typeSrt)
+	} else {
+		job.action = "extract"
+		job.outpath = templateName(srtpath, srtpath+".en.txt", langTag(srclang), typeTxt)
+	}
+
+	//已生成的文件不再处理，使用 -force 参数时重新生成
+	if _, serr := os.Stat(job.outpath); serr == nil && skipDone {
+		job.status = "SKIP"
+		if job.action == "merge" {
+			if slang == "en" {
+				job.message = "already generated: " + filepath.Base(job.outpath)
+			} else {
+				job.message = "已生成: " + filepath.Base(job.outpath)
+			}
+		} else {
+			if slang == "en" {
+				job.message = "waiting for translation: " + filepath.Base(job.outpath)
+			} else {
+				job.message = "等待翻译: " + filepath.Base(job.outpath)
+			}
+		}
+	}
+	return job
+}
+
+func runBatchJob(exepath string, args []string, job *batchJob) {
+	jobargs := append([]string{}, args...)
+	if job.action == "render" {
+		jobargs = append(jobargs, "-jsfile", job.jspath)
+	} else {
+		jobargs = append(jobargs, "-infile", job.srtpath)
+	}
+	if len(job.trpath) > 0 {
+		jobargs = append(jobargs, "-trfile", job.trpath)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(exepath, jobargs...)
+	cmd.Env = append(os.Environ(), batchEnv+"=1")
+	cmd.Stderr = &stderr
+	rerr := cmd.Run()
+
+	//按子进程的退出码确定结果：0 成功，batchWarnExit 有警告，其它为失败
+	job.message = lastMessage(stderr.String())
+	if rerr != nil {
+		if exiterr, ok := rerr.(*exec.ExitError); ok && exiterr.ExitCode() == batchWarnExit {
+			job.status = "WARN"
+			job.message = strings.TrimPrefix(job.message, batchWarnPrefix)
+			return
+		}
+		job.status = "FAIL"
+		if len(job.message) == 0 {
+			job.message = rerr.Error()
+		}
+		return
+	}
+	//正常退出但没有输出文件(如Matroska文件中没有文本字幕)
+	if _, serr := os.Stat(job.outpath); serr != nil {
+		job.status = "FAIL"
+		return
+	}
+	job.status = "OK"
+	job.message = filepath.Base(job.outpath)
+}
+
+//子进程输出中最有用的一行：panic 信息或最后一行
+func lastMessage(output string) string {
+	last := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "panic:") {
+			return line
+		}
+		if len(line) > 0 && !strings.HasPrefix(line, "Please check the file") &&
+			!strings.HasPrefix(line, "请查看文件") {
+			last = line
+		}
+	}
+	return last
+}
+
+func printBatchSummary(jobs []*batchJob) {
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tACTION\tFILE\tMESSAGE")
+	for _, job := range jobs {
+		counts[job.status]++
+		fmt.Fprintln(tw, job.status+"\t"+job.action+"\t"+job.srtpath+"\t"+job.message)
+	}
+	tw.Flush()
+
+	summary := "OK:" + strconv.Itoa(counts["OK"]) + "  WARN:" + strconv.Itoa(counts["WARN"]) +
+		"  FAIL:" + strconv.Itoa(counts["FAIL"]) + "  SKIP:" + strconv.Itoa(counts["SKIP"])
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "\n"+"Batch finished, "+strconv.Itoa(len(jobs))+" files. "+summary)
+	} else {
+		fmt.Fprintln(os.Stderr, "\n"+"批量处理完成，共 "+strconv.Itoa(len(jobs))+" 个文件. "+summary)
+	}
+}
+
+//查找要处理的srt字幕文件，多个目录或通配符用逗号分隔，-r 参数包含子目录
+func batchFiles(paths string) []string {
+	found := make(map[string]bool)
+	for _, pattern := range strings.Split(paths, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			fi, serr := os.Stat(match)
+			if serr != nil {
+				continue
+			}
+			if !fi.IsDir() {
+				if isBatchSrt(match) {
+					found[match] = true
+				}
+				continue
+			}
+			filepath.Walk(match, func(path string, info os.FileInfo, werr error) error {
+				if werr != nil {
+					return nil
+				}
+				if info.IsDir() {
+					if path != match && !brecurse {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if isBatchSrt(path) {
+					found[path] = true
+				}
+				return nil
+			})
+		}
+	}
+
+	var srtfiles []string
+	for path := range found {
+		srtfiles = append(srtfiles, path)
+	}
+	sort.Strings(srtfiles)
+	return srtfiles
+}
+
+//原文字幕文件，不包括本软件生成的字幕(Movie.chs.srt Movie.en.srt Movie.zh-Hans.srt 等)
+func isBatchSrt(path string) bool {
+	if !strings.HasSuffix(strings.ToLower(path), ".srt") {
+		return false
+	}
+	langext := strings.ToLower(filepath.Ext(path[0 : len(path)-4]))
+	switch langext {
+	case ".chs", ".cht", ".en", ".zh", ".zh-hans", ".zh-hant":
+		return false
+	}
+	return !strings.HasPrefix(filepath.Base(path), ".")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//由子进程的退出码确定结果，不比较输出文件的修改时间
+func TestRunBatchJob(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+	keepFlags(t)
+	tests := []struct {
+		name    string
+		script  string
+		output  bool
+		status  string
+		message string
+	}{
+		{"ok", "echo 'Please check the file: Movie.chs.srt .' >&2", true, "OK", "Movie.chs.srt"},
+		//上次生成的文件未改变时仍按退出码判断
+		{"unchanged", "exit 0", true, "OK", "Movie.chs.srt"},
+		{"no output", "echo 'No supported text subtitle track found' >&2", false, "FAIL", "No supported text subtitle track found"},
+		{"warn", "echo 'WARN: 2 untranslated sentences' >&2; exit 3", true, "WARN", "2 untranslated sentences"},
+		{"fail", "echo 'Movie.chs.srt already exists' >&2; exit 1", true, "FAIL", "Movie.chs.srt already exists"},
+		{"panic", "echo 'panic: bad' >&2; echo 'goroutine 1' >&2; exit 2", false, "FAIL", "panic: bad"},
+		{"silent", "exit 1", false, "FAIL", "exit status 1"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		exepath := filepath.Join(dir, "child.sh")
+		if werr := ioutil.WriteFile(exepath, []byte("#!/bin/sh\n"+tt.script+"\n"), 0755); werr != nil {
+			t.Fatal(werr)
+		}
+		job := &batchJob{srtpath: filepath.Join(dir, "Movie.srt"), action: "merge", outpath: filepath.Join(dir, "Movie.chs.srt")}
+		if tt.output {
+			if werr := ioutil.WriteFile(job.outpath, []byte("1\n"), 0644); werr != nil {
+				t.Fatal(werr)
+			}
+		}
+		runBatchJob(exepath, nil, job)
+		if job.status != tt.status || job.message != tt.message {
+			t.Errorf("%s: %s %q, want %s %q", tt.name, job.status, job.message, tt.status, tt.message)
+		}
+	}
+}
+
+func TestNewBatchJob(t *testing.T) {
+	keepFlags(t)
+	dir := t.TempDir()
+	write := func(name string) {
+		if werr := ioutil.WriteFile(filepath.Join(dir, name), []byte("1\n"), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+	}
+	write("A.srt")
+	write("B.srt")
+	write("B.srt.chs.txt")
+	write("C.srt")
+	write("C.zh.txt")
+	write("C.chs.srt")
+	tests := []struct {
+		name     string
+		skipDone bool
+		action   string
+		trpath   string
+		status   string
+	}{
+		{"A.srt", true, "extract", "", ""},
+		{"B.srt", true, "merge", "B.srt.chs.txt", ""},
+		{"C.srt", true, "merge", "C.zh.txt", "SKIP"},
+		{"C.srt", false, "merge", "C.zh.txt", ""},
+	}
+	for _, tt := range tests {
+		job := newBatchJob(filepath.Join(dir, tt.name), tt.skipDone)
+		trpath := ""
+		if len(job.trpath) > 0 {
+			trpath = filepath.Base(job.trpath)
+		}
+		if job.action != tt.action || trpath != tt.trpath || job.status != tt.status {
+			t.Errorf("%s skip %v: %s %q %s, want %s %q %s", tt.name, tt.skipDone, job.action, trpath, job.status, tt.action, tt.trpath, tt.status)
+		}
+	}
+}
+
+func TestBatchFiles(t *testing.T) {
+	defer func(r bool) { brecurse = r }(brecurse)
+	dir := t.TempDir()
+	for _, name := range []string{"A.srt", "A.chs.srt", "A.en.srt", "A.zh-Hans.srt", ".hidden.srt", "notes.txt", filepath.Join("sub", "B.srt")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if werr := ioutil.WriteFile(filepath.Join(dir, name), []byte("1\n"), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+	}
+	tests := []struct {
+		recurse bool
+		want    int
+	}{
+		{false, 1},
+		{true, 2},
+	}
+	for _, tt := range tests {
+		brecurse = tt.recurse
+		if got := batchFiles(dir + "," + filepath.Join(dir, "A.srt")); len(got) != tt.want {
+			t.Errorf("-r=%v: %v, want %d files", tt.recurse, got, tt.want)
+		}
+	}
+}
+
+//子进程使用命令行中的参数，批处理自身的参数不传递
+func TestBatchChildArgs(t *testing.T) {
+	keepFlags(t)
+	defer func(paths string, r bool) { batchpaths, brecurse = paths, r }(batchpaths, brecurse)
+	for _, arg := range [][2]string{{"batch", t.TempDir()}, {"r", "true"}, {"oenc", "gbk"}, {"force", "true"}} {
+		if serr := flag.Set(arg[0], arg[1]); serr != nil {
+			t.Fatal(serr)
+		}
+	}
+	exepath, all := batchChildArgs()
+	var args []string
+	for _, arg := range all {
+		//go test 的参数
+		if !strings.HasPrefix(arg, "-test.") {
+			args = append(args, arg)
+		}
+	}
+	if want := []string{"-force=true", "-oenc=gbk"}; len(exepath) == 0 || !reflect.DeepEqual(args, want) {
+		t.Errorf("batchChildArgs() = %q %q, want %q", exepath, args, want)
+	}
+}
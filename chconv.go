@@ -0,0 +1,313 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+//内置的常用字简繁转换表：约1000个常用字及两百多个词组，不是完整的OpenCC词典，
+//其它字词原样输出并列出；词典格式与OpenCC相同(每行 原词<Tab>转换词)，可用 -convdict 改用OpenCC词典
+//
+//go:embed dict/chconv/*.txt
+var chconvFS embed.FS
+
+//各转换方式依次使用的词典，与OpenCC的配置相同，每一步内词组优先于单字；词典目录中没有的文件跳过
+//(内置表没有 TWVariants.txt)
+var convModes = map[string][][]string{
+	"s2t":  {{"STPhrases.txt", "STCharacters.txt"}},
+	"t2s":  {{"TSPhrases.txt", "TSCharacters.txt"}},
+	"s2tw": {{"STPhrases.txt", "STCharacters.txt"}, {"TWPhrases.txt"}, {"TWVariants.txt"}},
+	"s2hk": {{"STPhrases.txt", "STCharacters.txt"}, {"HKVariants.txt"}},
+}
+
+//转换词典：-convdict 指定的OpenCC词典目录，否则为内置的常用字表
+func convDictFS() fs.FS {
+	if len(convdictpath) > 0 {
+		return os.DirFS(convdictpath)
+	}
+	sub, _ := fs.Sub(chconvFS, "dict/chconv")
+	return sub
+}
+
+type convDict struct {
+	table  map[string]string
+	maxLen int
+}
+
+//简繁转换器
+type chConverter struct {
+	mode  string
+	steps []*convDict
+	//使用内置转换表时，检查转换结果是否属于目标字形的字符集，记录不属于的汉字
+	charset encoding.Encoding
+	missed  []rune
+}
+
+func newChConverter(mode string) (*chConverter, error) {
+	mode = strings.ToLower(mode)
+	dictnames, ok := convModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown conversion: %s (s2t t2s s2tw s2hk)", mode)
+	}
+	conv := &chConverter{mode: mode}
+	dicts := convDictFS()
+	for _, stepnames := range dictnames {
+		step := &convDict{table: make(map[string]string)}
+		//先载入的词典优先
+		for _, name := range stepnames {
+			data, rerr := fs.ReadFile(dicts, name)
+			if errors.Is(rerr, fs.ErrNotExist) {
+				continue
+			}
+			if rerr != nil {
+				return nil, rerr
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+				if len(fields) < 2 || len(fields[0]) == 0 {
+					continue
+				}
+				if _, found := step.table[fields[0]]; found {
+					continue
+				}
+				//多个候选时取第一个，没有转换词的行跳过
+				values := strings.Fields(fields[1])
+				if len(values) == 0 {
+					continue
+				}
+				step.table[fields[0]] = values[0]
+				if n := len([]rune(fields[0])); n > step.maxLen {
+					step.maxLen = n
+				}
+			}
+		}
+		conv.steps = append(conv.steps, step)
+	}
+	//单字表是必须的，-convdict 目录错误时提示
+	if len(conv.steps[0].table) == 0 {
+		return nil, errors.New("no " + strings.Join(dictnames[0], " ") + " found in " + convdictpath)
+	}
+	if len(convdictpath) == 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "The built-in conversion tables only cover common characters and phrases, "+
+				"use -convdict with the OpenCC dictionaries for a complete conversion.")
+		} else {
+			fmt.Fprintln(os.Stderr, "内置转换表只包含常用字及词组，完整转换请用 -convdict 指定OpenCC词典目录.")
+		}
+		conv.charset = traditionalchinese.Big5
+		if strings.HasSuffix(mode, "2s") {
+			conv.charset = simplifiedchinese.HZGB2312
+		}
+	}
+	return conv, nil
+}
+
+//正向最长匹配转换
+func (d *convDict) convert(text string) string {
+	rtext := []rune(text)
+	var out strings.Builder
+	for i := 0; i < len(rtext); {
+		matched := false
+		for n := d.maxLen; n > 0; n-- {
+			if i+n > len(rtext) {
+				continue
+			}
+			if to, ok := d.table[string(rtext[i:i+n])]; ok {
+				out.WriteString(to)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out.WriteRune(rtext[i])
+			i++
+		}
+	}
+	return out.String()
+}
+
+func (c *chConverter) Convert(text string) string {
+	for _, step := range c.steps {
+		text = step.convert(text)
+	}
+	c.checkChars(text)
+	return text
+}
+
+//转换后不属于目标字形字符集(繁体为Big5，简体为GB2312)的汉字，可能是内置转换表中没有的字
+func (c *chConverter) checkChars(text string) {
+	if c.charset == nil {
+		return
+	}
+	for _, r := range text {
+		if !unicode.Is(unicode.Han, r) || strings.ContainsRune(string(c.missed), r) {
+			continue
+		}
+		if _, eerr := c.charset.NewEncoder().String(string(r)); eerr != nil {
+			c.missed = append(c.missed, r)
+		}
+	}
+}
+
+//列出可能未转换的字，最多列出50个
+func (c *chConverter) warnMissed() {
+	if len(c.missed) == 0 {
+		return
+	}
+	chars := string(c.missed)
+	if len(c.missed) > 50 {
+		chars = string(c.missed[0:50]) + " ..."
+	}
+	printWarning(strconv.Itoa(len(c.missed))+" characters are not in the built-in conversion tables and may be left unconverted "+
+		"(use -convdict with the OpenCC dictionaries): "+chars,
+		strconv.Itoa(len(c.missed))+" 个字不在内置转换表中，可能未转换(请用 -convdict 指定OpenCC词典): "+chars)
+}
+
+//转换后的文件名：Movie.chs.srt -> Movie.cht.srt
+func convOutPath(inpath, mode string) string {
+	tag := ".cht"
+	if strings.HasSuffix(strings.ToLower(mode), "2s") {
+		tag = ".chs"
+	}
+	ext := filepath.Ext(inpath)
+	base := inpath[0 : len(inpath)-len(ext)]
+	lbase := strings.ToLower(base)
+	if strings.HasSuffix(lbase, ".chs") || strings.HasSuffix(lbase, ".cht") {
+		base = base[0 : len(base)-4]
+	}
+	return base + tag + ext
+}
+
+//转换后的语言标记
+func convLangTag(mode string) string {
+	if strings.HasSuffix(strings.ToLower(mode), "2s") {
+		return "zh-Hans"
+	}
+	return "zh-Hant"
+}
+
+//合并生成字幕后，按 -conv 参数同时生成另一种字形的字幕
+//srcpath 为原输入文件名，用于文件名模板
+func convAfterMerge(subpath, srcpath string) error {
+	if len(convmode) == 0 {
+		return nil
+	}
+	//字幕已输出到标准输出时，无法再输出转换后的字幕
+	if subpath == "-" {
+		printWarning("-conv is ignored when the subtitle is written to standard output, use -convfile - instead.",
+			"字幕输出到标准输出时忽略-conv参数，请使用 -convfile - 进行转换。")
+		return nil
+	}
+	conv, cerr := newChConverter(convmode)
+	if cerr != nil {
+		return cerr
+	}
+	return convSubFile(conv, subpath, srcpath, true)
+}
+
+//转换已有的srt或json文件
+func ConvSubFile() {
+	_, lerr := os.Stat(convfilepath)
+	if convfilepath != "-" && os.IsNotExist(lerr) {
+		if slang == "en" {
+			fmt.Fprint(os.Stderr, "No files found:"+convfilepath+"\n")
+		} else {
+			fmt.Fprint(os.Stderr, "未发现文件:"+convfilepath+"\n")
+		}
+		os.Exit(1)
+	}
+	if len(convmode) == 0 {
+		convmode = "s2t"
+	}
+	conv, cerr := newChConverter(convmode)
+	if cerr != nil {
+		fmt.Fprintln(os.Stderr, cerr.Error())
+		os.Exit(1)
+	}
+	checkOutput(convSubFile(conv, convfilepath, convfilepath, false))
+}
+
+//merged 为 true 时，输入文件为本次按 -oenc 参数生成的字幕
+func convSubFile(conv *chConverter, inpath, srcpath string, merged bool) error {
+	outpath := convOutPath(inpath, conv.mode)
+	if outpath == inpath {
+		outpath = inpath + ".txt"
+	}
+	ftype := typeSrt
+	if strings.HasSuffix(strings.ToLower(inpath), ".json") {
+		ftype = typeJson
+	}
+	if merged {
+		outpath = templateName(srcpath, outpath, convLangTag(conv.mode), ftype)
+	} else {
+		outpath = outFileName(inpath, outpath, convLangTag(conv.mode), ftype)
+	}
+
+	if strings.HasSuffix(strings.ToLower(inpath), ".json") {
+		//json文件仅转换译文，并更新译文摘要
+		project := readProject(inpath)
+		jsubs := project.subs()
+		for i := range jsubs {
+			jsubs[i].DCSub = conv.Convert(jsubs[i].DCSub)
+			if len(jsubs[i].DCHash) > 0 {
+				jsubs[i].DCHash = subHash(jsubs[i].DCSub)
+			}
+			for j := range jsubs[i].SplitInfo {
+				jsubs[i].SplitInfo[j].SCSub = conv.Convert(jsubs[i].SplitInfo[j].SCSub)
+			}
+		}
+		project.setSubs(jsubs)
+		project.Languages.Target = convLangTag(conv.mode)
+		if oerr := checkJsonOverwrite(outpath); oerr != nil {
+			return oerr
+		}
+		saveProject(outpath, project)
+	} else {
+		//字幕文件按 -oenc -eol 参数输出
+		var intext []byte
+		var rerr error
+		if merged {
+			intext, rerr = ioutil.ReadFile(inpath)
+			intext = decodeOutEnc(intext)
+		} else {
+			intext, _, rerr = readTextFile(inpath)
+		}
+		if rerr != nil {
+			return rerr
+		}
+		outfile, oerr := openSubFile(outpath)
+		if oerr != nil {
+			return oerr
+		}
+		defer outfile.Close()
+		if _, werr := outfile.WriteString(conv.Convert(string(intext))); werr != nil {
+			return werr
+		}
+		if cerr := outfile.Close(); cerr != nil {
+			return cerr
+		}
+	}
+
+	conv.warnMissed()
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Converted ("+conv.mode+") file has been generated .")
+		fmt.Fprintln(os.Stderr, "Please check the file: "+outpath+" ."+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "生成简繁转换("+conv.mode+")后的文件.")
+		fmt.Fprintln(os.Stderr, "请查看文件: "+outpath+" ."+"\n")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChConverter(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		mode string
+		text string
+		want string
+	}{
+		//词组优先于单字
+		{"s2t", "头发和皇后", "頭髮和皇后"},
+		{"s2t", "国家发展", "國家發展"},
+		{"t2s", "國家發展", "国家发展"},
+		{"s2tw", "信息在里面", "資訊在裡面"},
+		{"s2hk", "信息在里面", "信息在裏面"},
+		{"S2T", "abc", "abc"},
+	}
+	for _, tt := range tests {
+		conv, cerr := newChConverter(tt.mode)
+		if cerr != nil {
+			t.Fatalf("%s: %v", tt.mode, cerr)
+		}
+		if got := conv.Convert(tt.text); got != tt.want {
+			t.Errorf("%s %q = %q, want %q", tt.mode, tt.text, got, tt.want)
+		}
+	}
+	if _, cerr := newChConverter("s2x"); cerr == nil {
+		t.Errorf("unknown conversion accepted")
+	}
+}
+
+//使用内置转换表时，列出转换后不属于目标字形字符集的字
+func TestChConverterMissed(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		mode string
+		text string
+		want string
+	}{
+		{"s2t", "这是缬草和鲟鱼，缬草", "缬鲟"},
+		{"t2s", "這是纈草", "纈"},
+		{"s2t", "国家发展", ""},
+	}
+	for _, tt := range tests {
+		conv, cerr := newChConverter(tt.mode)
+		if cerr != nil {
+			t.Fatalf("%s: %v", tt.mode, cerr)
+		}
+		conv.Convert(tt.text)
+		if got := string(conv.missed); got != tt.want {
+			t.Errorf("%s %q: missed %q, want %q", tt.mode, tt.text, got, tt.want)
+		}
+	}
+}
+
+//-convdict 指定的OpenCC词典代替内置转换表，没有的词典及没有转换词的行跳过
+func TestChConverterDict(t *testing.T) {
+	keepFlags(t)
+	defer func(path string) { convdictpath = path }(convdictpath)
+	convdictpath = t.TempDir()
+	files := map[string]string{
+		"STCharacters.txt": "干\t幹 乾 干\n台\t臺 檯 颱\n国\t\n",
+		"STPhrases.txt":    "干燥\t乾燥\n",
+		"TWVariants.txt":   "臺\t台\n",
+	}
+	for name, data := range files {
+		if werr := ioutil.WriteFile(filepath.Join(convdictpath, name), []byte(data), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+	}
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"s2t", "幹乾燥臺国"},
+		{"s2tw", "幹乾燥台国"},
+	}
+	for _, tt := range tests {
+		conv, cerr := newChConverter(tt.mode)
+		if cerr != nil {
+			t.Fatalf("%s: %v", tt.mode, cerr)
+		}
+		if got := conv.Convert("干干燥台国"); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+	if _, cerr := newChConverter("t2s"); cerr == nil || !strings.Contains(cerr.Error(), "TSCharacters.txt") {
+		t.Errorf("t2s without dictionaries: error %v", cerr)
+	}
+}
+
+func TestConvOutPath(t *testing.T) {
+	tests := []struct {
+		path string
+		mode string
+		want string
+		tag  string
+	}{
+		{"Movie.chs.srt", "s2t", "Movie.cht.srt", "zh-Hant"},
+		{"Movie.cht.srt", "t2s", "Movie.chs.srt", "zh-Hans"},
+		{"Movie.srt", "s2hk", "Movie.cht.srt", "zh-Hant"},
+		{"Movie.srt.json", "s2tw", "Movie.srt.cht.json", "zh-Hant"},
+	}
+	for _, tt := range tests {
+		if got := convOutPath(tt.path, tt.mode); got != tt.want {
+			t.Errorf("convOutPath(%q, %s) = %q, want %q", tt.path, tt.mode, got, tt.want)
+		}
+		if tag := convLangTag(tt.mode); tag != tt.tag {
+			t.Errorf("convLangTag(%s) = %q, want %q", tt.mode, tag, tt.tag)
+		}
+	}
+}
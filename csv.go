@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//表格文件，每行字幕一行，供审校人员用表格软件修改各行译文
+var csvFormat = exchangeFormat{
+	Name:   "CSV",
+	Export: func(p *subProject) ([]byte, error) { return exportTable(p, ',') },
+	Import: func(data []byte) ([]exchangeUnit, error) { return importTable(data, ',') },
+}
+
+var tsvFormat = exchangeFormat{
+	Name:   "TSV",
+	Export: func(p *subProject) ([]byte, error) { return exportTable(p, '\t') },
+	Import: func(data []byte) ([]exchangeUnit, error) { return importTable(data, '\t') },
+}
+
+//表格各列
+var tableColumns = []string{"index", "start", "end", "duration", "cps", "source", "target", "sentence", "notes"}
+
+var srtTimeReg = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[,.](\d{3})$`)
+
+//时间 00:01:02,500 转换为毫秒
+func parseSrtTime(s string) (int64, bool) {
+	m := srtTimeReg.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, false
+	}
+	var n [4]int64
+	for i := range n {
+		n[i], _ = strconv.ParseInt(m[i+1], 10, 64)
+	}
+	return ((n[0]*60+n[1])*60+n[2])*1000 + n[3], true
+}
+
+//拆分时间轴为开始及结束时间
+func splitTimeline(timeline string) (string, string) {
+	i := strings.Index(timeline, " --> ")
+	if i < 0 {
+		return timeline, ""
+	}
+	end := strings.Fields(timeline[i+5:] + " ")
+	if len(end) == 0 {
+		return timeline[0:i], ""
+	}
+	return timeline[0:i], end[0]
+}
+
+//一行字幕的时长(秒)及每秒字数，按译文计算，没有译文时按原文计算
+//时间轴无效时返回 0
+func lineCps(part subpart) (float64, float64) {
+	start, end := splitTimeline(part.STime)
+	smillis, sok := parseSrtTime(start)
+	emillis, eok := parseSrtTime(end)
+	if !sok || !eok || emillis <= smillis {
+		return 0, 0
+	}
+	seconds := float64(emillis-smillis) / 1000
+	text := part.SCSub
+	if len(strings.TrimSpace(text)) == 0 {
+		text = part.SSub
+	}
+	return seconds, float64(textLength(text)) / seconds
+}
+
+//字数，不计格式标记
+func textLength(text string) int {
+	return utf8.RuneCountInString(strings.TrimSpace(inlineTagReg.ReplaceAllString(text, "")))
+}
+
+func exportTable(p *subProject, comma rune) ([]byte, error) {
+	var b bytes.Buffer
+	//表格软件需要BOM才能识别utf-8
+	b.Write([]byte{0xEF, 0xBB, 0xBF})
+	w := csv.NewWriter(&b)
+	w.Comma = comma
+	w.UseCRLF = true
+	if werr := w.Write(tableColumns); werr != nil {
+		return nil, werr
+	}
+
+	for _, sub := range p.subs() {
+		for _, part := range sub.SplitInfo {
+			start, end := splitTimeline(part.STime)
+			duration, cps := "", ""
+			if seconds, lcps := lineCps(part); seconds > 0 {
+				duration = strconv.FormatFloat(seconds, 'f', 3, 64)
+				cps = strconv.FormatFloat(lcps, 'f', 1, 64)
+			}
+			row := []string{strconv.Itoa(part.SPos + 1), start, end, duration, cps,
+				part.SSub, part.SCSub, strconv.Itoa(sub.DPos), strings.Join(openComments(part.Flow), "\n")}
+			if werr := w.Write(row); werr != nil {
+				return nil, werr
+			}
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+//按表头确定各列位置，列的顺序可以调整，可以删除 duration cps source notes 列
+func importTable(data []byte, comma rune) ([]exchangeUnit, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, rerr := r.ReadAll()
+	if rerr != nil {
+		return nil, rerr
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"index", "start", "end", "target", "sentence"} {
+		if _, ok := col[name]; !ok {
+			return nil, errors.New("missing column \"" + name + "\" (" + strings.Join(tableColumns, " ") + ")")
+		}
+	}
+	cell := func(record []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var units []exchangeUnit
+	bypos := make(map[int]int)
+	for n, record := range records[1:] {
+		rowerr := func(msg string) error {
+			return errors.New("row " + strconv.Itoa(n+2) + ": " + msg)
+		}
+		if len(strings.TrimSpace(strings.Join(record, ""))) == 0 {
+			continue
+		}
+		index, ierr := strconv.Atoi(strings.TrimSpace(cell(record, "index")))
+		if ierr != nil || index < 1 {
+			return nil, rowerr("invalid index \"" + cell(record, "index") + "\"")
+		}
+		pos, perr := strconv.Atoi(strings.TrimSpace(cell(record, "sentence")))
+		if perr != nil {
+			return nil, rowerr("invalid sentence \"" + cell(record, "sentence") + "\"")
+		}
+		i, ok := bypos[pos]
+		if !ok {
+			i = len(units)
+			bypos[pos] = i
+			units = append(units, exchangeUnit{Pos: pos, Lines: []exchangeLine{}})
+		}
+		units[i].Lines = append(units[i].Lines, exchangeLine{
+			Pos:         index - 1,
+			Start:       strings.TrimSpace(cell(record, "start")),
+			End:         strings.TrimSpace(cell(record, "end")),
+			Translation: cell(record, "target"),
+			Note:        strings.TrimSpace(cell(record, "notes")),
+		})
+	}
+	return units, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//导出的表格导入后得到各行的时间轴、译文及未解决的评论，按句子分组
+func TestTableRoundTrip(t *testing.T) {
+	subs := testSubs()
+	subs[1].SplitInfo[1].SCSub = "去\"哪\",里\t？"
+	subs[1].SplitInfo[0].Flow.Comments = []subComment{{Text: "太短"}, {Text: "已改", Resolved: true}, {Text: "语气"}}
+	want := []exchangeUnit{
+		{Pos: 1, Lines: []exchangeLine{{Pos: 1, Start: "00:00:01,000", End: "00:00:02,500", Translation: "你好。"}}},
+		{Pos: 2, Lines: []exchangeLine{
+			{Pos: 2, Start: "00:00:03,000", End: "00:00:04,000", Translation: "你要", Note: "太短\n语气"},
+			{Pos: 3, Start: "00:00:04,000", End: "00:00:05,000", Translation: "去\"哪\",里\t？"},
+		}},
+	}
+	for _, comma := range []rune{',', '\t'} {
+		data, eerr := exportTable(newProject("Movie.srt", subs), comma)
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		units, ierr := importTable(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}), comma)
+		if ierr != nil || !reflect.DeepEqual(units, want) {
+			t.Errorf("separator %q: %+v %v, want %+v", comma, units, ierr, want)
+		}
+	}
+}
+
+func TestImportTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		lines   int
+		wanterr string
+	}{
+		{"reordered", "sentence,target,end,start,index\n1,你好。,00:00:02,00:00:01,2\n", 1, ""},
+		{"blank rows", "index,start,end,target,sentence\n\n,,,,\n2,00:00:01,00:00:02,你好。,1\n", 1, ""},
+		{"missing column", "index,start,end,target\n", 0, "missing column \"sentence\""},
+		{"index", "index,start,end,target,sentence\n0,00:00:01,00:00:02,你好。,1\n", 0, "row 2: invalid index"},
+		{"sentence", "index,start,end,target,sentence\n1,00:00:01,00:00:02,你好。,x\n", 0, "row 2: invalid sentence"},
+		{"empty", "", 0, "empty file"},
+	}
+	for _, tt := range tests {
+		units, ierr := importTable([]byte(tt.data), ',')
+		switch {
+		case len(tt.wanterr) > 0:
+			if ierr == nil || !strings.Contains(ierr.Error(), tt.wanterr) {
+				t.Errorf("%s: error %v, want %q", tt.name, ierr, tt.wanterr)
+			}
+		case ierr != nil || len(units) != 1 || len(units[0].Lines) != tt.lines || units[0].Lines[0].Translation != "你好。":
+			t.Errorf("%s: units %+v error %v", tt.name, units, ierr)
+		}
+	}
+}
+
+func TestLineCps(t *testing.T) {
+	tests := []struct {
+		time    string
+		source  string
+		target  string
+		seconds float64
+		cps     float64
+	}{
+		{"00:00:01,000 --> 00:00:03,000", "Hello there.", "<i>你好。</i>", 2, 1.5},
+		{"00:00:01,000 --> 00:00:03,000", "Hello there.", "", 2, 6},
+		{"00:00:03,000 --> 00:00:01,000", "Hello there.", "你好。", 0, 0},
+		{"00:00:01,000", "Hello there.", "你好。", 0, 0},
+	}
+	for _, tt := range tests {
+		seconds, cps := lineCps(subpart{STime: tt.time, SSub: tt.source, SCSub: tt.target})
+		if seconds != tt.seconds || cps != tt.cps {
+			t.Errorf("lineCps(%q, %q) = %v %v, want %v %v", tt.time, tt.target, seconds, cps, tt.seconds, tt.cps)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//-classify 时区分字幕类型：对白(空)、歌词 lyric、屏幕文字 sign、字幕组信息 credit
+//非对白的字幕单独成句，不与前后的对白合并；各类型按 -cuepolicy 翻译、保留原文或删除，并设置显示样式
+var cueTypes = []string{"lyric", "sign", "credit"}
+
+const defaultCuePolicy = "lyric=translate:italic+notes,sign=translate:top,credit=keep"
+
+//处理方式：translate 翻译 keep 保留原文 drop 删除；样式：plain italic top notes
+type cuePolicy struct {
+	Action string
+	Styles map[string]bool
+}
+
+var (
+	cueCreditReg = regexp.MustCompile(`(?i)\b(subtitles?|captions?|captioned|captioning|synced|sync|translated|translation|corrections?|ripped|encoded|subbed)\s+(by|and)\b|www\.|https?://|opensubtitles|addic7ed|©`)
+	cueLyricReg  = regexp.MustCompile(`^\s*(<[^>]*>|\{[^}]*\})*\s*[♪♫#]|[♪♫#]\s*(<[^>]*>)*\s*$`)
+	cueNoteReg   = regexp.MustCompile(`\s*[♪♫#]+\s*`)
+	cueSignReg   = regexp.MustCompile(`^\s*\{\\(an[5-9]|pos\()[^}]*\}`)
+	cueTagReg    = regexp.MustCompile(`^\s*\{[^}]*\}\s*`)
+	cuePolicies  map[string]cuePolicy
+)
+
+//解析 -cuepolicy，未指定的类型使用默认方式
+func loadCuePolicies() map[string]cuePolicy {
+	if cuePolicies != nil {
+		return cuePolicies
+	}
+	cuePolicies = make(map[string]cuePolicy)
+	for _, spec := range []string{defaultCuePolicy, cuepolicyspec} {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if len(item) == 0 {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || !validCueType(parts[0]) {
+				cuePolicyError(item)
+			}
+			action, styles := parts[1], ""
+			if i := strings.Index(action, ":"); i >= 0 {
+				action, styles = action[0:i], action[i+1:]
+			}
+			if action != "translate" && action != "keep" && action != "drop" {
+				cuePolicyError(item)
+			}
+			policy := cuePolicy{Action: action, Styles: make(map[string]bool)}
+			for _, style := range strings.Split(styles, "+") {
+				switch style {
+				case "", "plain":
+				case "italic", "top", "notes":
+					policy.Styles[style] = true
+				default:
+					cuePolicyError(item)
+				}
+			}
+			cuePolicies[parts[0]] = policy
+		}
+	}
+	return cuePolicies
+}
+
+func validCueType(name string) bool {
+	for _, t := range cueTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func cuePolicyError(item string) {
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Invalid -cuepolicy: \""+item+"\" (e.g. lyric=translate:italic+notes,sign=keep:top,credit=drop)")
+	} else {
+		fmt.Fprintln(os.Stderr, "-cuepolicy 参数错误: \""+item+"\" (如 lyric=translate:italic+notes,sign=keep:top,credit=drop)")
+	}
+	os.Exit(1)
+}
+
+//一条字幕的类型，text 为该条字幕的各行原文
+func classifyCue(lines []string, mixedcase bool) string {
+	text := strings.Join(lines, "\n")
+	plain := htmlTagReg.ReplaceAllString(text, "")
+	if !strings.ContainsAny(strings.ToLower(plain), "abcdefghijklmnopqrstuvwxyz") &&
+		len(strings.Trim(cueNoteReg.ReplaceAllString(plain, ""), " \n-")) == 0 {
+		//没有文字的字幕(如 ♪♪)按对白处理
+		return ""
+	}
+	switch {
+	case cueCreditReg.MatchString(plain):
+		return "credit"
+	case cueLyricReg.MatchString(lines[0]) || cueLyricReg.MatchString(lines[len(lines)-1]):
+		return "lyric"
+	case cueSignReg.MatchString(text):
+		return "sign"
+	case mixedcase && signCaps(plain):
+		return "sign"
+	}
+	return ""
+}
+
+//大小写正常的字幕中全大写的文字(不含声音描述及说话人)视为屏幕文字
+func signCaps(text string) bool {
+	text = strings.TrimSpace(cueTagReg.ReplaceAllString(text, ""))
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "(") || strings.HasPrefix(text, "-") || sdhSpeakerReg.MatchString(text) {
+		return false
+	}
+	letters := 0
+	for _, r := range text {
+		if r >= 'a' && r <= 'z' {
+			return false
+		}
+		if r >= 'A' && r <= 'Z' {
+			letters++
+		}
+	}
+	return letters >= 3
+}
+
+//按序号预先确定各条字幕的类型，-classify 未指定时返回 nil
+func classifyCues(intext []byte) map[int]string {
+	if !bclassify {
+		return nil
+	}
+	policies := loadCuePolicies()
+	mixedcase := !needTruecase(intext)
+	types := make(map[int]string)
+	counts := make(map[string]int)
+	var lines []string
+	num, state := 0, 0
+	flush := func() {
+		if num > 0 && len(lines) > 0 {
+			if t := classifyCue(lines, mixedcase); len(t) > 0 {
+				types[num] = t
+				counts[t]++
+			}
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(strings.Replace(string(intext), "\r", "", -1), "\n") {
+		line = strings.Replace(line, "\uFEFF", "", -1)
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+			flush()
+			state = 0
+		case state == 0 && srtNumReg.MatchString(strings.TrimSpace(line)):
+			num, _ = strconv.Atoi(strings.TrimSpace(line))
+			state = 1
+		case state == 1 && srtTimeLine.MatchString(line):
+			state = 2
+		default:
+			lines = append(lines, line)
+		}
+	}
+	flush()
+
+	var summary []string
+	for _, t := range cueTypes {
+		if counts[t] > 0 {
+			summary = append(summary, t+" "+strconv.Itoa(counts[t])+" ("+policies[t].Action+")")
+		}
+	}
+	if len(summary) > 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Non-dialogue cues: "+strings.Join(summary, ", "))
+		} else {
+			fmt.Fprintln(os.Stderr, "非对白字幕: "+strings.Join(summary, ", "))
+		}
+	}
+	return types
+}
+
+//该类型的字幕是否单独成句(删除的字幕不影响对白的合并)
+func cueBreaks(cuetype string) bool {
+	return len(cuetype) > 0 && loadCuePolicies()[cuetype].Action != "drop"
+}
+
+//该类型的字幕是否写入.en.txt 进行翻译
+func cueTranslated(cuetype string) bool {
+	return len(cuetype) == 0 || loadCuePolicies()[cuetype].Action == "translate"
+}
+
+//去掉歌词的 ♪ 及屏幕文字的位置标签，由输出样式重新添加
+func cleanCueText(cuetype, text string) string {
+	switch cuetype {
+	case "lyric":
+		text = cueNoteReg.ReplaceAllString(text, " ")
+	case "sign":
+		text = cueTagReg.ReplaceAllString(text, "")
+	}
+	return strings.TrimSpace(text)
+}
+
+//保留原文的字幕，译文即为原文
+func keepCueText(sub *subInfo) {
+	if cueTranslated(sub.Type) {
+		return
+	}
+	sub.DCSub = strings.TrimSpace(sub.DESub)
+	for k := range sub.SplitInfo {
+		sub.SplitInfo[k].SCSub = sub.SplitInfo[k].SSub
+	}
+	sub.DCHash = subHash(sub.DCSub)
+}
+
+//按类型的样式输出一行字幕，top 只加在第一行
+func cueStyle(cuetype, text string, first bool) string {
+	if len(cuetype) == 0 || len(strings.TrimSpace(text)) == 0 {
+		return text
+	}
+	styles := loadCuePolicies()[cuetype].Styles
+	if styles["notes"] {
+		text = "♪ " + text + " ♪"
+	}
+	if styles["italic"] {
+		text = "<i>" + text + "</i>"
+	}
+	if styles["top"] && first {
+		text = `{\an8}` + text
+	}
+	return text
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+//测试用的 -cuepolicy，结束时恢复
+func keepCuePolicy(t *testing.T, spec string) {
+	oldspec, oldpolicies := cuepolicyspec, cuePolicies
+	t.Cleanup(func() { cuepolicyspec, cuePolicies = oldspec, oldpolicies })
+	cuepolicyspec, cuePolicies = spec, nil
+}
+
+func TestClassifyCue(t *testing.T) {
+	tests := []struct {
+		lines     []string
+		mixedcase bool
+		want      string
+	}{
+		{[]string{"Where are you going?"}, true, ""},
+		{[]string{"♪ Hello darkness, my old friend ♪"}, true, "lyric"},
+		{[]string{"<i>♪ I've come to talk", "with you again</i>"}, true, "lyric"},
+		{[]string{`{\an8}Kansas City`}, true, "sign"},
+		{[]string{"KANSAS CITY, 1985"}, true, "sign"},
+		{[]string{"KANSAS CITY, 1985"}, false, ""},
+		{[]string{"[DOOR SLAMS]"}, true, ""},
+		{[]string{"JOHN: GET OUT!"}, true, ""},
+		{[]string{"Subtitles by explosiveskull"}, true, "credit"},
+		{[]string{"www.opensubtitles.org"}, true, "credit"},
+		{[]string{"♪ ♪"}, true, ""},
+	}
+	for _, tt := range tests {
+		if got := classifyCue(tt.lines, tt.mixedcase); got != tt.want {
+			t.Errorf("classifyCue(%q, %v) = %q, want %q", tt.lines, tt.mixedcase, got, tt.want)
+		}
+	}
+}
+
+//-cuepolicy 覆盖默认的处理方式及样式
+func TestCuePolicies(t *testing.T) {
+	tests := []struct {
+		spec   string
+		lyric  cuePolicy
+		credit cuePolicy
+	}{
+		{"", cuePolicy{"translate", map[string]bool{"italic": true, "notes": true}}, cuePolicy{"keep", map[string]bool{}}},
+		{"lyric=keep:plain,credit=drop", cuePolicy{"keep", map[string]bool{}}, cuePolicy{"drop", map[string]bool{}}},
+		{" lyric=translate:top+italic ", cuePolicy{"translate", map[string]bool{"top": true, "italic": true}}, cuePolicy{"keep", map[string]bool{}}},
+	}
+	for _, tt := range tests {
+		keepCuePolicy(t, tt.spec)
+		policies := loadCuePolicies()
+		if !reflect.DeepEqual(policies["lyric"], tt.lyric) || !reflect.DeepEqual(policies["credit"], tt.credit) {
+			t.Errorf("-cuepolicy %q: lyric %+v credit %+v, want %+v %+v", tt.spec, policies["lyric"], policies["credit"], tt.lyric, tt.credit)
+		}
+	}
+}
+
+func TestCueStyle(t *testing.T) {
+	keepCuePolicy(t, "")
+	tests := []struct {
+		cuetype string
+		text    string
+		first   bool
+		cleaned string
+		styled  string
+	}{
+		{"", "Hello.", true, "Hello.", "Hello."},
+		{"lyric", "♪ Hello darkness ♪", true, "Hello darkness", "<i>♪ Hello darkness ♪</i>"},
+		{"sign", `{\an8}Kansas City`, true, "Kansas City", `{\an8}Kansas City`},
+		{"sign", "1985", false, "1985", "1985"},
+		{"credit", "Subtitles by someone", true, "Subtitles by someone", "Subtitles by someone"},
+	}
+	for _, tt := range tests {
+		cleaned := cleanCueText(tt.cuetype, tt.text)
+		if cleaned != tt.cleaned {
+			t.Errorf("cleanCueText(%q, %q) = %q, want %q", tt.cuetype, tt.text, cleaned, tt.cleaned)
+		}
+		if got := cueStyle(tt.cuetype, cleaned, tt.first); got != tt.styled {
+			t.Errorf("cueStyle(%q, %q, %v) = %q, want %q", tt.cuetype, cleaned, tt.first, got, tt.styled)
+		}
+	}
+}
+
+//-classify 按字幕序号确定类型，大小写正常的字幕中全大写的行为屏幕文字
+func TestClassifyCues(t *testing.T) {
+	keepCuePolicy(t, "")
+	defer func(classify bool) { bclassify = classify }(bclassify)
+	bclassify = true
+	srt := "1\n00:00:01,000 --> 00:00:02,000\nKANSAS CITY, 1985\n\n" +
+		"2\n00:00:03,000 --> 00:00:04,000\nWhere are you going, John?\n\n" +
+		"3\n00:00:05,000 --> 00:00:06,000\n♪ Hello darkness, my old friend ♪\n\n" +
+		"4\n00:00:07,000 --> 00:00:08,000\nI have no idea what you mean.\nSubtitles by someone\n"
+	want := map[int]string{1: "sign", 3: "lyric", 4: "credit"}
+	if got := classifyCues([]byte(srt)); !reflect.DeepEqual(got, want) {
+		t.Errorf("classifyCues = %v, want %v", got, want)
+	}
+}
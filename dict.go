@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 内置的默认分词词典(只有几百个常用词)，未找到其它词典时使用并提示警告
+//
+//go:embed dict/dictionary.txt
+var defaultDictionary []byte
+
+var (
+	chsSeg        *chsSegmenter
+	segmenterOnce sync.Once
+)
+
+//载入分词词典，每个进程仅载入一次
+//基础词典依次为：-dict 参数、当前目录下、程序目录下的 dictionary.txt、内置词典
+//-udict 参数指定的用户词典叠加在基础词典之上
+func loadSegmenter() *chsSegmenter {
+	segmenterOnce.Do(func() {
+		chsSeg = &chsSegmenter{freqs: make(map[string]int)}
+		basedict := findDictionary()
+		if len(basedict) == 0 {
+			printWarning("No dictionary.txt found, using the built-in dictionary of only a few hundred common words; "+
+				"put the full sego dictionary.txt in the current or program folder for a proper segmentation.",
+				"未发现dictionary.txt词典文件，使用只有几百个常用词的内置词典；请将完整的 sego 词典 dictionary.txt 放在当前目录或程序目录下。")
+			chsSeg.loadDictionary(bytes.NewReader(defaultDictionary))
+		} else {
+			chsSeg.loadDictionaryFile(basedict)
+		}
+
+		for _, udict := range strings.Split(udictpaths, ",") {
+			udict = strings.TrimSpace(udict)
+			if len(udict) == 0 {
+				continue
+			}
+			if _, uerr := os.Stat(udict); os.IsNotExist(uerr) {
+				printWarning("No user dictionary found:"+udict, "未发现用户词典:"+udict)
+				continue
+			}
+			chsSeg.loadDictionaryFile(udict)
+		}
+	})
+	return chsSeg
+}
+
+//查找基础词典文件，未找到时返回空字符串
+func findDictionary() string {
+	if len(dictpath) > 0 {
+		if _, derr := os.Stat(dictpath); os.IsNotExist(derr) {
+			if slang == "en" {
+				fmt.Fprint(os.Stderr, "No dictionary files found:"+dictpath+"\n")
+				fmt.Fprint(os.Stderr, "-dict dictionary filename"+"\n")
+			} else {
+				fmt.Fprint(os.Stderr, "未发现词典文件:"+dictpath+"\n")
+				fmt.Fprint(os.Stderr, "-dict 词典文件名"+"\n")
+			}
+			os.Exit(1)
+		}
+		return dictpath
+	}
+
+	if _, derr := os.Stat("dictionary.txt"); derr == nil {
+		return "dictionary.txt"
+	}
+	if exepath, eerr := os.Executable(); eerr == nil {
+		exedict := filepath.Join(filepath.Dir(exepath), "dictionary.txt")
+		if _, derr := os.Stat(exedict); derr == nil {
+			return exedict
+		}
+	}
+	return ""
+}
+
+//未登录的单个字元的距离
+const unknownDistance = 32
+
+//中文分词，按词典词频选取总距离最短的切分方式，距离为 log2(总词频/词频)
+//连续的拉丁字母及数字作为一个字元(参照 sego 的算法)
+type chsSegmenter struct {
+	freqs  map[string]int
+	total  int
+	maxLen int //词典中最长词的字元数
+}
+
+//载入词典文件，每行为：词 词频 [词性]
+func (s *chsSegmenter) loadDictionaryFile(dictfile string) {
+	f, ferr := os.Open(dictfile)
+	checkError(ferr)
+	defer f.Close()
+	s.loadDictionary(f)
+}
+
+//词频小于 2 的词忽略，后载入的词典覆盖先前的词频
+func (s *chsSegmenter) loadDictionary(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		freq, ferr := strconv.Atoi(fields[1])
+		if ferr != nil || freq < 2 {
+			continue
+		}
+		word := fields[0]
+		s.total += freq - s.freqs[word]
+		s.freqs[word] = freq
+		if n := len(splitUnits(word)); n > s.maxLen {
+			s.maxLen = n
+		}
+	}
+	checkError(scanner.Err())
+}
+
+//按字元切分：连续的拉丁字母及数字为一个字元，其它每个字符为一个字元
+func splitUnits(text string) []string {
+	var units []string
+	start := -1
+	for i, r := range text {
+		if utf8.RuneLen(r) <= 2 && (unicode.IsLetter(r) || unicode.IsNumber(r)) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			units = append(units, text[start:i])
+			start = -1
+		}
+		units = append(units, string(r))
+	}
+	if start >= 0 {
+		units = append(units, text[start:])
+	}
+	return units
+}
+
+func (s *chsSegmenter) Segment(text string) []string {
+	units := splitUnits(text)
+	//dist[j] 为前 j 个字元的最短距离，from[j] 为最后一个分词的起点
+	dist := make([]float64, len(units)+1)
+	from := make([]int, len(units)+1)
+	maxlen := s.maxLen
+	if maxlen < 1 {
+		maxlen = 1
+	}
+	for j := 1; j <= len(units); j++ {
+		dist[j] = math.Inf(1)
+		for i := j - 1; i >= 0 && j-i <= maxlen; i-- {
+			d := float64(unknownDistance)
+			if freq, ok := s.freqs[strings.Join(units[i:j], "")]; ok {
+				d = math.Log2(float64(s.total)) - math.Log2(float64(freq))
+			} else if j-i > 1 {
+				continue
+			}
+			if dist[i]+d < dist[j] {
+				dist[j], from[j] = dist[i]+d, i
+			}
+		}
+	}
+
+	tokens := make([]string, 0, len(units))
+	for j := len(units); j > 0; j = from[j] {
+		token := strings.Join(units[from[j]:j], "")
+		if r, _ := utf8.DecodeRuneInString(token); unicode.IsSpace(r) {
+			token = " "
+		}
+		tokens = append(tokens, token)
+	}
+	for i, j := 0, len(tokens)-1; i < j; i, j = i+1, j-1 {
+		tokens[i], tokens[j] = tokens[j], tokens[i]
+	}
+	return tokens
+}
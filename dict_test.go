@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//基础词典的查找顺序：-dict 参数、当前目录下的 dictionary.txt、内置词典
+func TestFindDictionary(t *testing.T) {
+	defer func(path string) { dictpath = path }(dictpath)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	dir := t.TempDir()
+	userdict := filepath.Join(dir, "user.txt")
+	if werr := ioutil.WriteFile(userdict, []byte("字幕 10 n\n"), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	tests := []struct {
+		name  string
+		dict  string
+		local bool
+		want  string
+	}{
+		{"-dict", userdict, true, userdict},
+		{"current directory", "", true, "dictionary.txt"},
+		{"built-in", "", false, ""},
+	}
+	for _, tt := range tests {
+		wdir := t.TempDir()
+		if tt.local {
+			if werr := ioutil.WriteFile(filepath.Join(wdir, "dictionary.txt"), []byte("字幕 10 n\n"), 0644); werr != nil {
+				t.Fatal(werr)
+			}
+		}
+		if cerr := os.Chdir(wdir); cerr != nil {
+			t.Fatal(cerr)
+		}
+		dictpath = tt.dict
+		if got := findDictionary(); got != tt.want {
+			t.Errorf("%s: findDictionary() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+//按词频选取最短距离的切分，连续的字母数字为一个字元，空白为 " "
+func TestChsSegmenter(t *testing.T) {
+	s := &chsSegmenter{freqs: make(map[string]int)}
+	s.loadDictionary(strings.NewReader("中国 100 ns\n中国人 50 n\n人民 80 n\n国人 1 n\n我们 60 r\nT恤 10 n\n"))
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"中国人民", []string{"中国", "人民"}},
+		{"我们中国人", []string{"我们", "中国人"}},
+		{"买T恤abc 123个", []string{"买", "T恤", "abc", " ", "123", "个"}},
+		{"你\t好", []string{"你", " ", "好"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := s.Segment(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Segment(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if _, ok := s.freqs["国人"]; ok {
+		t.Error("words with frequency below 2 should be ignored")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+//输出文件字符集
+type outEncoding struct {
+	enc encoding.Encoding
+	bom []byte
+}
+
+var outEncodings = map[string]outEncoding{
+	"utf-8":     {nil, nil},
+	"utf-8-bom": {nil, []byte{0xEF, 0xBB, 0xBF}},
+	"gbk":       {simplifiedchinese.GBK, nil},
+	"gb18030":   {simplifiedchinese.GB18030, nil},
+	"big5":      {traditionalchinese.Big5, nil},
+	"utf-16le":  {unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), []byte{0xFF, 0xFE}},
+	"utf-16be":  {unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), []byte{0xFE, 0xFF}},
+}
+
+//检查 -oenc -eol 参数
+func checkOutEncoding() {
+	oencname = strings.ToLower(oencname)
+	eolname = strings.ToLower(eolname)
+	_, ok := outEncodings[oencname]
+	if !ok || (eolname != "lf" && eolname != "crlf") {
+		if slang == "en" {
+			fmt.Fprint(os.Stderr, "Unsupported output encoding or line ending:"+oencname+" "+eolname+"\n")
+			fmt.Fprint(os.Stderr, "-oenc utf-8 utf-8-bom gbk gb18030 big5 utf-16le utf-16be  -eol lf crlf"+"\n")
+		} else {
+			fmt.Fprint(os.Stderr, "不支持的输出字符集或换行符:"+oencname+" "+eolname+"\n")
+			fmt.Fprint(os.Stderr, "-oenc utf-8 utf-8-bom gbk gb18030 big5 utf-16le utf-16be  -eol lf crlf"+"\n")
+		}
+		os.Exit(1)
+	}
+}
+
+//按 -oenc -eol 参数写入字幕文件，无法编码的字符以 ? 代替并在关闭时提示
+type subWriter struct {
+	file     *os.File
+	stdout   bool
+	closed   bool
+	name     string
+	oenc     outEncoding
+	crlf     bool
+	badRunes map[rune]int
+}
+
+//创建输出文件，内容先写入临时文件，关闭时改名为目标文件；
+//已存在的文件需要 -force 参数才能覆盖；文件名为 - 时输出到标准输出
+func openSubFile(filename string) (*subWriter, error) {
+	file := os.Stdout
+	if filename != "-" {
+		if oerr := checkOverwrite(filename); oerr != nil {
+			return nil, oerr
+		}
+		var ferr error
+		file, ferr = createTempFile(filename)
+		if ferr != nil {
+			return nil, ferr
+		}
+	}
+	w := &subWriter{
+		file:     file,
+		stdout:   filename == "-",
+		name:     filename,
+		oenc:     outEncodings[oencname],
+		crlf:     eolname == "crlf",
+		badRunes: make(map[rune]int),
+	}
+	if len(w.oenc.bom) > 0 {
+		if _, werr := file.Write(w.oenc.bom); werr != nil {
+			if !w.stdout {
+				file.Close()
+				os.Remove(file.Name())
+			}
+			return nil, werr
+		}
+	}
+	return w, nil
+}
+
+func (w *subWriter) WriteString(s string) (int, error) {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if w.crlf {
+		s = strings.Replace(s, "\n", "\r\n", -1)
+	}
+	if w.oenc.enc == nil {
+		return w.file.WriteString(s)
+	}
+
+	data, eerr := w.oenc.enc.NewEncoder().Bytes([]byte(s))
+	if eerr != nil {
+		//逐字编码，记录无法编码的字符
+		var buf bytes.Buffer
+		encoder := w.oenc.enc.NewEncoder()
+		for _, r := range s {
+			rdata, rerr := encoder.Bytes([]byte(string(r)))
+			if rerr != nil {
+				w.badRunes[r]++
+				buf.WriteByte('?')
+				continue
+			}
+			buf.Write(rdata)
+		}
+		data = buf.Bytes()
+	}
+	return w.file.Write(data)
+}
+
+func (w *subWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.badRunes) > 0 {
+		var runes []string
+		for r, n := range w.badRunes {
+			runes = append(runes, string(r)+" x"+strconv.Itoa(n))
+		}
+		sort.Strings(runes)
+		printWarning("Characters that cannot be encoded in "+oencname+" were replaced by ? in "+w.name+":",
+			"以下字符无法以 "+oencname+" 编码，已在 "+w.name+" 中替换为 ? :")
+		fmt.Fprintln(os.Stderr, "  "+strings.Join(runes, "  ")+"\n")
+		w.badRunes = make(map[rune]int)
+	}
+	if w.stdout {
+		return nil
+	}
+	if cerr := w.file.Close(); cerr != nil {
+		os.Remove(w.file.Name())
+		return cerr
+	}
+	return renameTempFile(w.file.Name(), w.name)
+}
+
+//按 -oenc 参数将输出文件内容还原为utf-8
+func decodeOutEnc(data []byte) []byte {
+	oenc := outEncodings[oencname]
+	data = bytes.TrimPrefix(data, oenc.bom)
+	if oenc.enc == nil {
+		return data
+	}
+	ddata, derr := oenc.enc.NewDecoder().Bytes(data)
+	if derr != nil {
+		return data
+	}
+	return ddata
+}
+
+//读取输入文件(字幕、译文、json)，按BOM、-ienc 参数或自动判断的字符集转换为utf-8
+//返回转换后的内容及字符集名称
+//文件名为 - 时由标准输入读取
+func readTextFile(filename string) ([]byte, string, error) {
+	data, rerr := readInput(filename)
+	if rerr != nil {
+		return nil, "", rerr
+	}
+
+	//有BOM标志时直接确定字符集
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:], "UTF-8", nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE, 0x00, 0x00}):
+		return decodeInEnc(data[4:], "UTF-32LE"), "UTF-32LE", nil
+	case bytes.HasPrefix(data, []byte{0x00, 0x00, 0xFE, 0xFF}):
+		return decodeInEnc(data[4:], "UTF-32BE"), "UTF-32BE", nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeInEnc(data[2:], "UTF-16LE"), "UTF-16LE", nil
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeInEnc(data[2:], "UTF-16BE"), "UTF-16BE", nil
+	}
+
+	charset := iencname
+	if len(charset) == 0 {
+		charset = DetectFCharset(data)
+	}
+	return decodeInEnc(data, charset), charset, nil
+}
+
+//标准输入仅能读取一次
+var stdinRead bool
+
+func readInput(filename string) ([]byte, error) {
+	if filename != "-" {
+		return ioutil.ReadFile(filename)
+	}
+	if stdinRead {
+		return nil, errors.New("standard input (-) can only be used for one input file")
+	}
+	stdinRead = true
+	return ioutil.ReadAll(os.Stdin)
+}
+
+//按字符集名称转换为utf-8，不支持的字符集保留原内容
+func decodeInEnc(data []byte, charset string) []byte {
+	enc := lookupEncoding(charset)
+	if enc == nil {
+		return data
+	}
+	ddata, derr := enc.NewDecoder().Bytes(data)
+	if derr != nil {
+		return data
+	}
+	return ddata
+}
+
+//字符集名称(chardet 及 -ienc 参数)对应的编码，utf-8 及不支持的字符集返回nil
+func lookupEncoding(charset string) encoding.Encoding {
+	name := strings.ToLower(strings.TrimSpace(charset))
+	switch name {
+	case "", "utf-8", "utf8", "ascii", "us-ascii":
+		return nil
+	case "gb-18030", "gb18030", "gbk", "gb2312":
+		return simplifiedchinese.GB18030
+	case "utf-16", "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case "utf-32", "utf-32le":
+		return utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)
+	case "utf-32be":
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)
+	}
+	enc, lerr := htmlindex.Get(name)
+	if lerr != nil || enc == encoding.Replacement {
+		printWarning("Unsupported character set, the file is read as is: "+charset,
+			"不支持的字符集，按原内容读取文件: "+charset)
+		return nil
+	}
+	return enc
+}
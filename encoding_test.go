@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//按 -oenc -eol 写入字幕，无法编码的字符替换为 ?
+func TestSubWriter(t *testing.T) {
+	defer func(oenc, eol string) { oencname, eolname = oenc, eol }(oencname, eolname)
+	tests := []struct {
+		oenc string
+		eol  string
+		text string
+		want []byte
+	}{
+		{"utf-8", "lf", "你好\r\n", []byte("你好\n")},
+		{"utf-8-bom", "crlf", "你好\n", []byte("\xEF\xBB\xBF你好\r\n")},
+		{"gbk", "lf", "你好\n", []byte{0xC4, 0xE3, 0xBA, 0xC3, '\n'}},
+		{"gbk", "lf", "你好😀\n", []byte{0xC4, 0xE3, 0xBA, 0xC3, '?', '\n'}},
+		{"big5", "crlf", "你好\n", []byte{0xA7, 0x41, 0xA6, 0x6E, '\r', '\n'}},
+		{"utf-16le", "lf", "A\n", []byte{0xFF, 0xFE, 'A', 0, '\n', 0}},
+		{"utf-16be", "crlf", "A\n", []byte{0xFE, 0xFF, 0, 'A', 0, '\r', 0, '\n'}},
+	}
+	for _, tt := range tests {
+		oencname, eolname = tt.oenc, tt.eol
+		name := filepath.Join(t.TempDir(), "Movie.chs.srt")
+		w, oerr := openSubFile(name)
+		if oerr != nil {
+			t.Fatal(oerr)
+		}
+		w.WriteString(tt.text)
+		if cerr := w.Close(); cerr != nil {
+			t.Fatal(cerr)
+		}
+		data, _ := ioutil.ReadFile(name)
+		if !bytes.Equal(data, tt.want) {
+			t.Errorf("-oenc %s -eol %s: % x, want % x", tt.oenc, tt.eol, data, tt.want)
+		}
+		if tt.eol == "lf" && !strings.Contains(tt.text, "😀") {
+			if got, want := string(decodeOutEnc(data)), strings.Replace(tt.text, "\r\n", "\n", -1); got != want {
+				t.Errorf("-oenc %s: decoded %q, want %q", tt.oenc, got, want)
+			}
+		}
+	}
+}
+
+//按BOM或 -ienc 参数确定输入文件的字符集
+func TestReadTextFile(t *testing.T) {
+	defer func(name string) { iencname = name }(iencname)
+	tests := []struct {
+		ienc    string
+		data    []byte
+		charset string
+	}{
+		{"", []byte("\xEF\xBB\xBF你好"), "UTF-8"},
+		{"", []byte{0xFF, 0xFE, 0x60, 0x4F, 0x7D, 0x59}, "UTF-16LE"},
+		{"", []byte{0xFE, 0xFF, 0x4F, 0x60, 0x59, 0x7D}, "UTF-16BE"},
+		{"", []byte{0xFF, 0xFE, 0, 0, 0x60, 0x4F, 0, 0, 0x7D, 0x59, 0, 0}, "UTF-32LE"},
+		{"", []byte{0, 0, 0xFE, 0xFF, 0, 0, 0x4F, 0x60, 0, 0, 0x59, 0x7D}, "UTF-32BE"},
+		{"gbk", []byte{0xC4, 0xE3, 0xBA, 0xC3}, "gbk"},
+		{"big5", []byte{0xA7, 0x41, 0xA6, 0x6E}, "big5"},
+		{"utf-8", []byte("你好"), "utf-8"},
+		//BOM优先于 -ienc 参数
+		{"gbk", []byte("\xEF\xBB\xBF你好"), "UTF-8"},
+	}
+	for _, tt := range tests {
+		iencname = tt.ienc
+		name := filepath.Join(t.TempDir(), "Movie.srt")
+		if werr := ioutil.WriteFile(name, tt.data, 0644); werr != nil {
+			t.Fatal(werr)
+		}
+		data, charset, rerr := readTextFile(name)
+		if rerr != nil || string(data) != "你好" || charset != tt.charset {
+			t.Errorf("-ienc %q % x: %q %s %v, want %q %s", tt.ienc, tt.data, data, charset, rerr, "你好", tt.charset)
+		}
+	}
+}
+
+func TestLookupEncoding(t *testing.T) {
+	tests := []struct {
+		charset string
+		utf8    bool
+	}{
+		{"UTF-8", true},
+		{"ascii", true},
+		{"", true},
+		{"GB-18030", false},
+		{"Shift_JIS", false},
+		{"windows-1252", false},
+		{"no-such-charset", true},
+	}
+	for _, tt := range tests {
+		if enc := lookupEncoding(tt.charset); (enc == nil) != tt.utf8 {
+			t.Errorf("lookupEncoding(%q) = %v, want read as is %v", tt.charset, enc, tt.utf8)
+		}
+	}
+}
+
+//标准输入只能作为一个输入文件，- 作为输出文件时写入标准输出
+func TestStandardStreams(t *testing.T) {
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() { os.Stdin, os.Stdout, stdinRead = stdin, stdout, false }()
+	stdinRead = false
+	inr, inw, _ := os.Pipe()
+	outr, outw, _ := os.Pipe()
+	os.Stdin, os.Stdout = inr, outw
+	inw.WriteString("1\n")
+	inw.Close()
+
+	tests := []struct {
+		name    string
+		wanterr bool
+	}{
+		{"-", false},
+		{"-", true},
+	}
+	for k, tt := range tests {
+		if data, rerr := readInput(tt.name); (rerr != nil) != tt.wanterr || (rerr == nil && string(data) != "1\n") {
+			t.Errorf("read %d of %q: %q %v, want error %v", k+1, tt.name, data, rerr, tt.wanterr)
+		}
+	}
+
+	w, oerr := openSubFile("-")
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	w.WriteString("你好\n")
+	w.Close()
+	outw.Close()
+	data, _ := ioutil.ReadAll(outr)
+	if string(data) != "你好\n" {
+		t.Errorf("standard output %q, want %q", data, "你好\n")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//字幕句状态，与XLIFF 2.0 segment state 一致
+var cueStates = map[string]int{
+	"initial":    0,
+	"translated": 1,
+	"reviewed":   2,
+	"final":      3,
+}
+
+//导入文件中的一句译文
+type exchangeUnit struct {
+	Pos         int
+	Translation string
+	State       string
+	//待确认的译文(PO fuzzy)，不导入
+	Fuzzy bool
+	//按行修改的译文(表格文件)，不为nil时直接替换各行译文，不重新切分
+	Lines []exchangeLine
+}
+
+//导入文件中的一行字幕，序号及时间轴用于检查是否与json文件一致
+type exchangeLine struct {
+	Pos         int
+	Start       string
+	End         string
+	Translation string
+	Note        string
+}
+
+//交换文件格式(供CAT工具、翻译平台等使用)，按扩展名确定
+type exchangeFormat struct {
+	Name   string
+	Export func(p *subProject) ([]byte, error)
+	Import func(data []byte) ([]exchangeUnit, error)
+}
+
+var exchangeFormats = map[string]exchangeFormat{
+	".xlf":   xliffFormat,
+	".xliff": xliffFormat,
+	".po":    poFormat,
+	".pot":   potFormat,
+	".csv":   csvFormat,
+	".tsv":   tsvFormat,
+}
+
+func lookupExchangeFormat(filename string) exchangeFormat {
+	format, ok := exchangeFormats[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		var exts []string
+		for ext := range exchangeFormats {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Unsupported exchange file format:"+filename)
+		} else {
+			fmt.Fprintln(os.Stderr, "不支持的交换文件格式:"+filename)
+		}
+		fmt.Fprintln(os.Stderr, strings.Join(exts, " "))
+		os.Exit(1)
+	}
+	return format
+}
+
+//句子状态由审校状态确定：译文为空或仍为机器翻译时为 initial
+func cueState(sub subInfo) string {
+	if state, ok := statusStates[sub.Flow.Status]; ok && len(sub.DCSub) > 0 {
+		return state
+	}
+	return "initial"
+}
+
+//句子序号列表，最多列出20个
+func joinPos(pos []string) string {
+	if len(pos) > 20 {
+		return strings.Join(pos[0:20], " ") + " ..."
+	}
+	return strings.Join(pos, " ")
+}
+
+//检查各行的序号及时间轴是否与json文件中的句子一致，最多列出10个错误
+func checkUnitLines(units []exchangeUnit, allsub []subInfo, bypos map[int]int) error {
+	var problems []string
+	add := func(pos int, msg string) {
+		if len(problems) < 10 {
+			problems = append(problems, "sentence "+strconv.Itoa(pos)+": "+msg)
+		}
+	}
+	rows := make(map[int]bool)
+	for _, unit := range units {
+		if unit.Lines == nil {
+			continue
+		}
+		rows[unit.Pos] = true
+		i, ok := bypos[unit.Pos]
+		if !ok {
+			add(unit.Pos, "not found in the json file")
+			continue
+		}
+		parts := allsub[i].SplitInfo
+		if len(unit.Lines) != len(parts) {
+			add(unit.Pos, strconv.Itoa(len(unit.Lines))+" rows, the json file has "+strconv.Itoa(len(parts))+" lines")
+			continue
+		}
+		for k, line := range unit.Lines {
+			start, end := splitTimeline(parts[k].STime)
+			if line.Pos != parts[k].SPos {
+				add(unit.Pos, "row index "+strconv.Itoa(line.Pos+1)+" should be "+strconv.Itoa(parts[k].SPos+1))
+			} else if line.Start != start || line.End != end {
+				add(unit.Pos, "row "+strconv.Itoa(line.Pos+1)+" timing "+line.Start+" --> "+line.End+
+					" was changed, should be "+start+" --> "+end)
+			}
+		}
+	}
+	//按行导入时，json文件中的每句字幕都应有对应的行
+	if len(rows) > 0 {
+		for _, sub := range allsub {
+			if len(sub.SplitInfo) > 0 && !rows[sub.DPos] {
+				add(sub.DPos, "no rows, the json file has "+strconv.Itoa(len(sub.SplitInfo))+" lines")
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
+
+//中文、日文、韩文，词之间没有空格
+func isCjkLang(lang string) bool {
+	lang = strings.ToLower(lang)
+	for _, cjk := range []string{"zh", "ja", "ko"} {
+		if strings.HasPrefix(lang, cjk) {
+			return true
+		}
+	}
+	return false
+}
+
+//各行译文合并为整句，中文、日文、韩文直接连接，其它语言以空格分隔
+func joinLines(lang string, lines []string) string {
+	if isCjkLang(lang) {
+		return strings.Join(lines, "")
+	}
+	var words []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			words = append(words, line)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+//导出json项目文件为交换文件
+func ExportProject() {
+	format := lookupExchangeFormat(exportpath)
+	project := readProject(josnfilepath)
+	data, eerr := format.Export(project)
+	checkError(eerr)
+
+	if exportpath == "-" {
+		_, werr := os.Stdout.Write(data)
+		checkError(werr)
+	} else {
+		checkOutput(checkOverwrite(exportpath))
+		tmpfile, terr := createTempFile(exportpath)
+		checkError(terr)
+		_, werr := tmpfile.Write(data)
+		tmpfile.Close()
+		if werr != nil {
+			os.Remove(tmpfile.Name())
+			checkError(werr)
+		}
+		checkError(renameTempFile(tmpfile.Name(), exportpath))
+	}
+
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Exported "+strconv.Itoa(len(project.Cues))+" sentences to "+format.Name+".")
+		fmt.Fprintln(os.Stderr, "Please translate the file: "+exportpath+" , then import it with -jsfile "+josnfilepath+" -import "+exportpath+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "已导出 "+strconv.Itoa(len(project.Cues))+" 句字幕为"+format.Name+"文件.")
+		fmt.Fprintln(os.Stderr, "请翻译文件: "+exportpath+" ，然后使用 -jsfile "+josnfilepath+" -import "+exportpath+" 导入"+"\n")
+	}
+}
+
+//导入交换文件中的译文，重新切分被修改的句子并生成字幕
+func ImportProject() {
+	format := lookupExchangeFormat(importpath)
+	data, _, rerr := readTextFile(importpath)
+	checkError(rerr)
+	units, ierr := format.Import(data)
+	if ierr != nil {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Invalid "+format.Name+" file: "+importpath)
+		} else {
+			fmt.Fprintln(os.Stderr, format.Name+"文件格式错误: "+importpath)
+		}
+		fmt.Fprintln(os.Stderr, ierr.Error())
+		os.Exit(1)
+	}
+
+	project := readProject(josnfilepath)
+	allsub := project.subs()
+	bypos := make(map[int]int)
+	for i := range allsub {
+		bypos[allsub[i].DPos] = i
+	}
+
+	//表格文件的行被增删或时间轴被修改时不导入
+	if lerr := checkUnitLines(units, allsub, bypos); lerr != nil {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "The rows of "+importpath+" do not match the json file, nothing was imported:")
+		} else {
+			fmt.Fprintln(os.Stderr, importpath+" 中的行与json文件不一致，未导入:")
+		}
+		fmt.Fprintln(os.Stderr, lerr.Error())
+		os.Exit(1)
+	}
+
+	srcseg := langSegmenter(srclang)
+	tgseg := langSegmenter(tglang)
+	updated := 0
+	var unknown, untranslated, fuzzy, notes []string
+	for _, unit := range units {
+		i, ok := bypos[unit.Pos]
+		if !ok {
+			unknown = append(unknown, strconv.Itoa(unit.Pos))
+			continue
+		}
+		if unit.Lines != nil {
+			var texts []string
+			changed := false
+			for k, line := range unit.Lines {
+				texts = append(texts, line.Translation)
+				changed = changed || line.Translation != allsub[i].SplitInfo[k].SCSub
+				//notes列的每行备注保存为该行字幕的评论
+				for _, note := range strings.Split(line.Note, "\n") {
+					note = strings.TrimSpace(note)
+					if len(note) > 0 && addComment(&allsub[i].SplitInfo[k].Flow, currentUser(), nowTime(), note) {
+						notes = append(notes, strconv.Itoa(line.Pos+1)+": "+note)
+					}
+				}
+			}
+			unit.Translation = joinLines(tglang, texts)
+			if len(strings.TrimSpace(unit.Translation)) == 0 {
+				untranslated = append(untranslated, strconv.Itoa(unit.Pos))
+				continue
+			}
+			if changed {
+				for k := range unit.Lines {
+					allsub[i].SplitInfo[k].SCSub = texts[k]
+				}
+				allsub[i].DCSub = unit.Translation
+				allsub[i].DCHash = subHash(unit.Translation)
+				touchSub(&allsub[i], "post-edited", true)
+				updated++
+			}
+			continue
+		}
+		//未翻译及待确认的句子保留原译文
+		if unit.Fuzzy {
+			fuzzy = append(fuzzy, strconv.Itoa(unit.Pos))
+			continue
+		}
+		if len(unit.Translation) == 0 {
+			untranslated = append(untranslated, strconv.Itoa(unit.Pos))
+			continue
+		}
+		changed := unit.Translation != allsub[i].DCSub
+		if changed {
+			allsub[i].DCSub = unit.Translation
+			splitSubLine(srcseg, tgseg, &allsub[i])
+			touchSub(&allsub[i], "post-edited", true)
+			updated++
+		}
+		//CAT工具中的句子状态，译文未修改时不降低状态，修改后的译文不再视为机器翻译
+		if status := stateStatus(unit.State); len(status) > 0 && status != allsub[i].Flow.Status && !(changed && status == "mt") {
+			touchSub(&allsub[i], status, changed)
+		}
+	}
+	if len(unknown) > 0 {
+		printWarning("Sentences not found in the json file were ignored: "+joinPos(unknown),
+			"json文件中没有以下句子，已忽略: "+joinPos(unknown))
+	}
+	if len(untranslated) > 0 {
+		printWarning(strconv.Itoa(len(untranslated))+" untranslated sentences: "+joinPos(untranslated),
+			strconv.Itoa(len(untranslated))+" 句未翻译: "+joinPos(untranslated))
+	}
+	if len(fuzzy) > 0 {
+		printWarning(strconv.Itoa(len(fuzzy))+" fuzzy sentences were not imported: "+joinPos(fuzzy),
+			strconv.Itoa(len(fuzzy))+" 句待确认(fuzzy)的译文未导入: "+joinPos(fuzzy))
+	}
+	if len(notes) > 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Reviewer notes saved as comments (-comments to list them):")
+		} else {
+			fmt.Fprintln(os.Stderr, "审校备注已保存为评论(-comments 列出):")
+		}
+		fmt.Fprintln(os.Stderr, strings.Join(notes, "\n"))
+	}
+
+	//先更新辅助json文件，字幕文件不能生成(如已存在)时不丢失导入的译文
+	//json由标准输入读取时按 -jsout 参数输出
+	project.setSubs(allsub)
+	if josnfilepath != "-" {
+		saveProject(josnfilepath, project)
+	} else if len(jsoutpath) > 0 {
+		saveProject(jsoutpath, project)
+	}
+
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Imported "+strconv.Itoa(updated)+" modified sentences from "+importpath+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "由 "+importpath+" 导入 "+strconv.Itoa(updated)+" 句修改的译文."+"\n")
+	}
+
+	//json由标准输入读取时已无法再次读取，直接由修改后的项目生成字幕
+	checkOutput(renderProject(project))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckUnitLines(t *testing.T) {
+	allsub := testSubs()
+	bypos := map[int]int{1: 0, 2: 1}
+	line := func(pos int, start, end, text string) exchangeLine {
+		return exchangeLine{Pos: pos, Start: start, End: end, Translation: text}
+	}
+	first := exchangeUnit{Pos: 1, Lines: []exchangeLine{line(1, "00:00:01,000", "00:00:02,500", "你好。")}}
+	second := exchangeUnit{Pos: 2, Lines: []exchangeLine{
+		line(2, "00:00:03,000", "00:00:04,000", "你要"),
+		line(3, "00:00:04,000", "00:00:05,000", "去哪里？"),
+	}}
+	tests := []struct {
+		name  string
+		units []exchangeUnit
+		want  string
+	}{
+		{"unchanged", []exchangeUnit{first, second}, ""},
+		{"sentences", []exchangeUnit{{Pos: 1, Translation: "你好。"}}, ""},
+		{"row deleted", []exchangeUnit{first, {Pos: 2, Lines: second.Lines[0:1]}}, "sentence 2: 1 rows, the json file has 2 lines"},
+		{"sentence deleted", []exchangeUnit{second}, "sentence 1: no rows, the json file has 1 lines"},
+		{"sentence added", []exchangeUnit{first, second, {Pos: 3, Lines: second.Lines}}, "sentence 3: not found"},
+		{"index", []exchangeUnit{first, {Pos: 2, Lines: []exchangeLine{second.Lines[1], second.Lines[0]}}}, "row index 4 should be 3"},
+		{"timing", []exchangeUnit{{Pos: 1, Lines: []exchangeLine{line(1, "00:00:01,000", "00:00:03,000", "你好。")}}, second}, "timing 00:00:01,000 --> 00:00:03,000 was changed"},
+	}
+	for _, tt := range tests {
+		lerr := checkUnitLines(tt.units, allsub, bypos)
+		if len(tt.want) == 0 {
+			if lerr != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, lerr)
+			}
+		} else if lerr == nil || !strings.Contains(lerr.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, lerr, tt.want)
+		}
+	}
+}
+
+//导入修改后的表格文件，更新json文件(备注保存为评论)并由修改后的项目生成字幕
+func TestImportProjectTable(t *testing.T) {
+	keepFlags(t)
+	defer func(path string) { importpath = path }(importpath)
+	tests := []struct {
+		stdin bool
+	}{
+		{false},
+		{true},
+	}
+	for _, tt := range tests {
+		jspath := writeTestProject(t, testSubs())
+		dir := filepath.Dir(jspath)
+		data, eerr := exportTable(readProject(jspath), ',')
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		importpath = filepath.Join(dir, "Movie.csv")
+		edited := strings.Replace(string(data), ",去哪里？,2,", ",去哪儿？,2,太口语", 1)
+		if werr := ioutil.WriteFile(importpath, []byte(edited), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+		josnfilepath, jsoutpath, outpath = jspath, "", ""
+		if tt.stdin {
+			stdin, oerr := os.Open(jspath)
+			if oerr != nil {
+				t.Fatal(oerr)
+			}
+			defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+			os.Stdin = stdin
+			defer stdin.Close()
+			josnfilepath = "-"
+			jsoutpath = filepath.Join(dir, "out.json")
+			outpath = filepath.Join(dir, "out.srt")
+		}
+
+		ImportProject()
+
+		savedpath, subpath := jspath, jsonChsFileName(jspath)
+		if tt.stdin {
+			savedpath, subpath = jsoutpath, outpath
+		}
+		sub := readProject(savedpath).subs()[1]
+		if sub.DCSub != "你要去哪儿？" || sub.SplitInfo[1].SCSub != "去哪儿？" || sub.Flow.Status != "post-edited" {
+			t.Errorf("stdin %v: imported sentence %q lines %q status %q", tt.stdin, sub.DCSub, sub.SplitInfo[1].SCSub, sub.Flow.Status)
+		}
+		if comments := openComments(sub.SplitInfo[1].Flow); len(comments) != 1 || comments[0] != "太口语" {
+			t.Errorf("stdin %v: notes saved as comments %q", tt.stdin, comments)
+		}
+		rendered, rerr := ioutil.ReadFile(subpath)
+		if rerr != nil || !strings.Contains(string(rendered), "去哪儿？") {
+			t.Errorf("stdin %v: subtitle %q, error %v", tt.stdin, rendered, rerr)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/jikaimail/SubtitleTranslation
+
+go 1.18
+
+require (
+	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d
+	golang.org/x/text v0.14.0
+)
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+//Matroska(EBML)元素ID
+const (
+	mkvSegment           = 0x18538067
+	mkvInfo              = 0x1549A966
+	mkvTimecodeScale     = 0x2AD7B1
+	mkvTracks            = 0x1654AE6B
+	mkvTrackEntry        = 0xAE
+	mkvTrackNumber       = 0xD7
+	mkvTrackType         = 0x83
+	mkvCodecID           = 0x86
+	mkvCodecPrivate      = 0x63A2
+	mkvLanguage          = 0x22B59C
+	mkvLanguageIETF      = 0x22B59D
+	mkvName              = 0x536E
+	mkvFlagDefault       = 0x88
+	mkvFlagForced        = 0x55AA
+	mkvContentEncodings  = 0x6D80
+	mkvContentEncoding   = 0x6240
+	mkvContentEncType    = 0x5033
+	mkvContentCompress   = 0x5034
+	mkvContentCompAlgo   = 0x4254
+	mkvContentCompParams = 0x4255
+	mkvCluster           = 0x1F43B675
+	mkvTimecode          = 0xE7
+	mkvSimpleBlock       = 0xA3
+	mkvBlockGroup        = 0xA0
+	mkvBlock             = 0xA1
+	mkvBlockDuration     = 0x9B
+
+	mkvTypeSubtitle = 0x11
+)
+
+//进入解析的容器元素，其它元素按长度跳过
+var mkvMasters = map[uint64]bool{
+	mkvSegment: true, mkvInfo: true, mkvTracks: true, mkvTrackEntry: true,
+	mkvContentEncodings: true, mkvContentEncoding: true, mkvContentCompress: true,
+	mkvCluster: true, mkvBlockGroup: true,
+}
+
+//支持提取的文本字幕格式
+var mkvTextCodecs = map[string]bool{
+	"S_TEXT/UTF8": true, "S_TEXT/ASS": true, "S_TEXT/SSA": true,
+	"S_TEXT/WEBVTT": true, "D_WEBVTT/SUBTITLES": true,
+}
+
+//语言代码对应的Matroska语言(ISO 639-2)
+var mkvLangCodes = map[string][]string{
+	"en": {"eng"},
+	"zh": {"chi", "zho"},
+	"ja": {"jpn"},
+	"ko": {"kor"},
+	"fr": {"fre", "fra"},
+	"de": {"ger", "deu"},
+	"es": {"spa"},
+	"ru": {"rus"},
+}
+
+type mkvTrack struct {
+	Number   uint64
+	Type     uint64
+	Codec    string
+	Private  []byte
+	Language string
+	LangIETF string
+	Name     string
+	Default  bool
+	Forced   bool
+	//压缩方式：-1 未压缩 0 zlib 3 去除头部
+	compAlgo   int
+	compParams []byte
+}
+
+//字幕块，时间单位为纳秒
+type mkvCue struct {
+	start    int64
+	duration int64
+	data     []byte
+}
+
+//Matroska文件(.mkv .mks .webm)
+func isMkvFile(inpath string) bool {
+	switch strings.ToLower(inpath[strings.LastIndex(inpath, ".")+1:]) {
+	case "mkv", "mks", "webm":
+		return true
+	}
+	return false
+}
+
+type ebmlReader struct {
+	file *os.File
+	pos  int64
+	//文件长度，读取元素内容前检查
+	size int64
+}
+
+//读取元素ID及长度，长度未知时 unknown 为 true
+func (r *ebmlReader) next() (id uint64, size int64, unknown bool, err error) {
+	var buf [12]byte
+	n, rerr := r.file.ReadAt(buf[:], r.pos)
+	if n == 0 {
+		if rerr == nil {
+			rerr = io.EOF
+		}
+		return 0, 0, false, rerr
+	}
+	idlen := vintLen(buf[0])
+	if idlen == 0 || idlen > 4 || idlen >= n {
+		return 0, 0, false, errors.New("invalid EBML element at " + strconv.FormatInt(r.pos, 10))
+	}
+	for _, b := range buf[0:idlen] {
+		id = id<<8 | uint64(b)
+	}
+	sizelen := vintLen(buf[idlen])
+	if sizelen == 0 || idlen+sizelen > n {
+		return 0, 0, false, errors.New("invalid EBML element size at " + strconv.FormatInt(r.pos, 10))
+	}
+	value := uint64(buf[idlen]) & (0xFF >> uint(sizelen))
+	allones := value == 0xFF>>uint(sizelen)
+	for _, b := range buf[idlen+1 : idlen+sizelen] {
+		value = value<<8 | uint64(b)
+		allones = allones && b == 0xFF
+	}
+	r.pos += int64(idlen + sizelen)
+	return id, int64(value), allones, nil
+}
+
+//读取元素内容，长度超出文件剩余部分时返回错误，不分配内存
+func (r *ebmlReader) read(size int64) ([]byte, error) {
+	if size < 0 || size > r.size-r.pos {
+		return nil, errors.New("EBML element size " + strconv.FormatInt(size, 10) + " exceeds the file at " + strconv.FormatInt(r.pos, 10))
+	}
+	data := make([]byte, size)
+	_, rerr := r.file.ReadAt(data, r.pos)
+	r.pos += size
+	return data, rerr
+}
+
+//跳过元素内容，超出文件时停在文件末尾
+func (r *ebmlReader) skip(size int64) {
+	if size > r.size-r.pos {
+		r.pos = r.size
+		return
+	}
+	r.pos += size
+}
+
+//变长整数的字节数
+func vintLen(b byte) int {
+	for i := 0; i < 8; i++ {
+		if b&(0x80>>uint(i)) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func ebmlUint(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+//解析Matroska文件的轨道信息；want 不为0时同时读取该轨道的字幕块
+func parseMkv(mkvpath string, want uint64) ([]*mkvTrack, []mkvCue, error) {
+	file, ferr := os.Open(mkvpath)
+	if ferr != nil {
+		return nil, nil, ferr
+	}
+	defer file.Close()
+	info, serr := file.Stat()
+	if serr != nil {
+		return nil, nil, serr
+	}
+
+	r := &ebmlReader{file: file, size: info.Size()}
+	var tracks []*mkvTrack
+	var cues []mkvCue
+	var track *mkvTrack
+	var wanttrack *mkvTrack
+	scale := int64(1000000)
+	var cluster int64
+	//BlockGroup 内的字幕块，用于设置显示时长
+	groupcue := -1
+
+	for {
+		id, size, unknown, nerr := r.next()
+		if nerr == io.EOF {
+			break
+		}
+		if nerr != nil {
+			return tracks, cues, nerr
+		}
+
+		if mkvMasters[id] {
+			switch id {
+			case mkvTrackEntry:
+				track = &mkvTrack{Language: "eng", Default: true, compAlgo: -1}
+				tracks = append(tracks, track)
+			case mkvContentCompress:
+				if track != nil {
+					track.compAlgo = 0
+				}
+			case mkvCluster:
+				//仅需要轨道信息时不再读取字幕块
+				if want == 0 {
+					return tracks, cues, nil
+				}
+				track = nil
+				if wanttrack == nil {
+					for _, t := range tracks {
+						if t.Number == want {
+							wanttrack = t
+						}
+					}
+					if wanttrack == nil {
+						return tracks, cues, errors.New("track not found: " + strconv.FormatUint(want, 10))
+					}
+				}
+			case mkvBlockGroup:
+				groupcue = -1
+			}
+			continue
+		}
+		if unknown {
+			return tracks, cues, errors.New("unsupported EBML element of unknown size at " + strconv.FormatInt(r.pos, 10))
+		}
+
+		switch id {
+		case mkvTimecodeScale, mkvTimecode, mkvBlockDuration,
+			mkvTrackNumber, mkvTrackType, mkvFlagDefault, mkvFlagForced, mkvContentCompAlgo, mkvContentEncType,
+			mkvCodecID, mkvCodecPrivate, mkvLanguage, mkvLanguageIETF, mkvName, mkvContentCompParams:
+			data, rerr := r.read(size)
+			if rerr != nil {
+				return tracks, cues, rerr
+			}
+			switch id {
+			case mkvTimecodeScale:
+				scale = int64(ebmlUint(data))
+			case mkvTimecode:
+				cluster = int64(ebmlUint(data))
+			case mkvBlockDuration:
+				if groupcue >= 0 {
+					cues[groupcue].duration = int64(ebmlUint(data)) * scale
+				}
+			}
+			if track == nil {
+				continue
+			}
+			switch id {
+			case mkvTrackNumber:
+				track.Number = ebmlUint(data)
+			case mkvTrackType:
+				track.Type = ebmlUint(data)
+			case mkvFlagDefault:
+				track.Default = ebmlUint(data) != 0
+			case mkvFlagForced:
+				track.Forced = ebmlUint(data) != 0
+			case mkvContentCompAlgo:
+				track.compAlgo = int(ebmlUint(data))
+			case mkvContentEncType:
+				//加密的轨道无法读取
+				if ebmlUint(data) != 0 {
+					track.compAlgo = -2
+				}
+			case mkvCodecID:
+				track.Codec = strings.TrimRight(string(data), "\x00")
+			case mkvCodecPrivate:
+				track.Private = data
+			case mkvLanguage:
+				track.Language = strings.TrimRight(string(data), "\x00")
+			case mkvLanguageIETF:
+				track.LangIETF = strings.TrimRight(string(data), "\x00")
+			case mkvName:
+				track.Name = strings.TrimRight(string(data), "\x00")
+			case mkvContentCompParams:
+				track.compParams = data
+			}
+
+		case mkvSimpleBlock, mkvBlock:
+			if wanttrack == nil {
+				r.skip(size)
+				continue
+			}
+			//先读取轨道号，其它轨道(视频、音频)直接跳过
+			var head [8]byte
+			n, _ := r.file.ReadAt(head[:], r.pos)
+			tlen := vintLen(head[0])
+			if tlen == 0 || tlen+3 > n || int64(tlen+3) > size {
+				r.skip(size)
+				continue
+			}
+			tnum := uint64(head[0]) & (0xFF >> uint(tlen))
+			for _, b := range head[1:tlen] {
+				tnum = tnum<<8 | uint64(b)
+			}
+			if tnum != wanttrack.Number {
+				r.skip(size)
+				continue
+			}
+			data, rerr := r.read(size)
+			if rerr != nil {
+				return tracks, cues, rerr
+			}
+			reltime := int64(int16(uint16(data[tlen])<<8 | uint16(data[tlen+1])))
+			//字幕块不使用 lacing
+			if data[tlen+2]&0x06 != 0 {
+				continue
+			}
+			payload, derr := wanttrack.decode(data[tlen+3:])
+			if derr != nil {
+				return tracks, cues, derr
+			}
+			cues = append(cues, mkvCue{start: (cluster + reltime) * scale, data: payload})
+			if id == mkvBlock {
+				groupcue = len(cues) - 1
+			}
+
+		default:
+			r.skip(size)
+		}
+	}
+	return tracks, cues, nil
+}
+
+//解压字幕块内容
+func (t *mkvTrack) decode(data []byte) ([]byte, error) {
+	switch t.compAlgo {
+	case -1:
+		return data, nil
+	case 0:
+		zr, zerr := zlib.NewReader(bytes.NewReader(data))
+		if zerr != nil {
+			return nil, zerr
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	case 3:
+		return append(append([]byte{}, t.compParams...), data...), nil
+	}
+	return nil, errors.New("unsupported compression or encryption in track " + strconv.FormatUint(t.Number, 10))
+}
+
+//是否为可提取的文本字幕轨道
+func (t *mkvTrack) isText() bool {
+	return t.Type == mkvTypeSubtitle && mkvTextCodecs[strings.ToUpper(t.Codec)]
+}
+
+//轨道语言是否与 lang 参数一致
+func (t *mkvTrack) matchLang(lang string) bool {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[0:i]
+	}
+	tlang := strings.ToLower(t.LangIETF)
+	if i := strings.IndexAny(tlang, "-_"); i > 0 {
+		tlang = tlang[0:i]
+	}
+	if tlang == lang {
+		return true
+	}
+	for _, code := range append(mkvLangCodes[lang], lang) {
+		if strings.ToLower(t.Language) == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *mkvTrack) language() string {
+	if len(t.LangIETF) > 0 {
+		return t.LangIETF
+	}
+	return t.Language
+}
+
+//选择要提取的字幕轨道：-track 参数指定，否则选择与 -srclang 语言一致的非强制字幕
+func chooseMkvTrack(tracks []*mkvTrack) *mkvTrack {
+	if mkvtrack > 0 {
+		for _, t := range tracks {
+			if t.Number == uint64(mkvtrack) {
+				return t
+			}
+		}
+		return nil
+	}
+	var first, langmatch *mkvTrack
+	for _, t := range tracks {
+		if !t.isText() {
+			continue
+		}
+		if first == nil {
+			first = t
+		}
+		if t.matchLang(srclang) {
+			if !t.Forced {
+				return t
+			}
+			if langmatch == nil {
+				langmatch = t
+			}
+		}
+	}
+	if langmatch != nil {
+		return langmatch
+	}
+	return first
+}
+
+//列出Matroska文件中的字幕轨道
+func ListMkvTracks(mkvpath string) {
+	tracks, _, perr := parseMkv(mkvpath, 0)
+	checkMkvError(mkvpath, perr)
+
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRACK\tCODEC\tLANGUAGE\tNAME\tFLAGS")
+	for _, t := range tracks {
+		if t.Type != mkvTypeSubtitle {
+			continue
+		}
+		var flags []string
+		if t.Default {
+			flags = append(flags, "default")
+		}
+		if t.Forced {
+			flags = append(flags, "forced")
+		}
+		if !t.isText() {
+			if slang == "en" {
+				flags = append(flags, "not supported")
+			} else {
+				flags = append(flags, "不支持")
+			}
+		}
+		fmt.Fprintln(tw, strconv.FormatUint(t.Number, 10)+"\t"+t.Codec+"\t"+t.language()+"\t"+t.Name+"\t"+strings.Join(flags, ","))
+	}
+	tw.Flush()
+}
+
+//Matroska文件无法读取或格式错误时提示并退出
+func checkMkvError(mkvpath string, merr error) {
+	if merr == nil {
+		return
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Invalid Matroska file: "+mkvpath)
+	} else {
+		fmt.Fprintln(os.Stderr, "Matroska文件格式错误: "+mkvpath)
+	}
+	fmt.Fprintln(os.Stderr, merr.Error())
+	os.Exit(1)
+}
+
+//由Matroska文件提取文本字幕，转换为srt格式
+func extractMkvSub(mkvpath string) ([]byte, error) {
+	tracks, _, perr := parseMkv(mkvpath, 0)
+	if perr != nil {
+		return nil, perr
+	}
+	track := chooseMkvTrack(tracks)
+	if track == nil || !track.isText() {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "No supported text subtitle track found, use -listtracks to list the tracks and -track to choose one.")
+		} else {
+			fmt.Fprintln(os.Stderr, "未发现支持的文本字幕轨道，使用-listtracks列出字幕轨道，-track选择字幕轨道。")
+		}
+		ListMkvTracks(mkvpath)
+		os.Exit(1)
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Extract subtitle track "+strconv.FormatUint(track.Number, 10)+" ("+track.language()+" "+track.Codec+" "+track.Name+")"+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "提取字幕轨道 "+strconv.FormatUint(track.Number, 10)+" ("+track.language()+" "+track.Codec+" "+track.Name+")"+"\n")
+	}
+
+	_, cues, perr := parseMkv(mkvpath, track.Number)
+	if perr != nil {
+		return nil, perr
+	}
+	return mkvCuesToSrt(track, cues), nil
+}
+
+var (
+	assTagReg  = regexp.MustCompile(`\{[^}]*\}`)
+	htmlTagReg = regexp.MustCompile(`<[^>]*>`)
+)
+
+//字幕块内容转换为无格式文本
+func mkvCueText(track *mkvTrack, data []byte) string {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	switch strings.ToUpper(track.Codec) {
+	case "S_TEXT/ASS", "S_TEXT/SSA":
+		//ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+		fields := strings.SplitN(text, ",", 9)
+		if len(fields) < 9 {
+			return ""
+		}
+		text = assTagReg.ReplaceAllString(fields[8], "")
+		text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+	default:
+		text = htmlTagReg.ReplaceAllString(text, "")
+		text = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", " ").Replace(text)
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+//无显示时长的字幕默认显示到下一条字幕，最长2秒
+const mkvDefaultDuration = 2000000000
+
+func mkvCuesToSrt(track *mkvTrack, cues []mkvCue) []byte {
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].start < cues[j].start })
+	var out bytes.Buffer
+	num := 0
+	for i, cue := range cues {
+		text := mkvCueText(track, cue.data)
+		if len(text) == 0 {
+			continue
+		}
+		end := cue.start + cue.duration
+		if cue.duration <= 0 {
+			end = cue.start + mkvDefaultDuration
+			if i+1 < len(cues) && cues[i+1].start > cue.start && cues[i+1].start < end {
+				end = cues[i+1].start
+			}
+		}
+		num++
+		out.WriteString(strconv.Itoa(num) + "\n")
+		out.WriteString(srtTime(cue.start) + " --> " + srtTime(end) + "\n")
+		out.WriteString(text + "\n\n")
+	}
+	return out.Bytes()
+}
+
+//纳秒转换为srt时间格式 00:00:00,000
+func srtTime(ns int64) string {
+	if ns < 0 {
+		ns = 0
+	}
+	ms := ns / 1000000
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//EBML元素：ID、8字节长度、内容
+func ebmlElement(id uint64, children ...[]byte) []byte {
+	var b bytes.Buffer
+	var idbuf [8]byte
+	binary.BigEndian.PutUint64(idbuf[:], id)
+	b.Write(bytes.TrimLeft(idbuf[:], "\x00"))
+	var content bytes.Buffer
+	for _, c := range children {
+		content.Write(c)
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(content.Len()))
+	size[0] = 0x01
+	b.Write(size[:])
+	b.Write(content.Bytes())
+	return b.Bytes()
+}
+
+func ebmlUintElement(id uint64, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return ebmlElement(id, buf[:])
+}
+
+//字幕块：轨道号、相对时间、标志、内容
+func mkvTestBlock(id uint64, track byte, reltime int16, text string) []byte {
+	head := []byte{0x80 | track, byte(uint16(reltime) >> 8), byte(reltime), 0x80}
+	return ebmlElement(id, head, []byte(text))
+}
+
+//视频轨道、英文srt字幕、日文ass字幕及英文强制字幕
+func writeTestMkv(t *testing.T, extra ...[]byte) string {
+	t.Helper()
+	tracks := ebmlElement(mkvTracks,
+		ebmlElement(mkvTrackEntry, ebmlUintElement(mkvTrackNumber, 1), ebmlUintElement(mkvTrackType, 1),
+			ebmlElement(mkvCodecID, []byte("V_MPEG4/ISO/AVC"))),
+		ebmlElement(mkvTrackEntry, ebmlUintElement(mkvTrackNumber, 2), ebmlUintElement(mkvTrackType, mkvTypeSubtitle),
+			ebmlElement(mkvCodecID, []byte("S_TEXT/UTF8")), ebmlElement(mkvLanguage, []byte("eng")), ebmlElement(mkvName, []byte("English"))),
+		ebmlElement(mkvTrackEntry, ebmlUintElement(mkvTrackNumber, 3), ebmlUintElement(mkvTrackType, mkvTypeSubtitle),
+			ebmlElement(mkvCodecID, []byte("S_TEXT/ASS")), ebmlElement(mkvLanguage, []byte("jpn")),
+			ebmlElement(mkvCodecPrivate, []byte("[Script Info]\nScriptType: v4.00+\n"))),
+		ebmlElement(mkvTrackEntry, ebmlUintElement(mkvTrackNumber, 4), ebmlUintElement(mkvTrackType, mkvTypeSubtitle),
+			ebmlElement(mkvCodecID, []byte("S_TEXT/UTF8")), ebmlElement(mkvLanguage, []byte("eng")),
+			ebmlUintElement(mkvFlagForced, 1), ebmlElement(mkvName, []byte("Signs"))),
+	)
+	cluster := ebmlElement(mkvCluster,
+		ebmlUintElement(mkvTimecode, 1000),
+		mkvTestBlock(mkvSimpleBlock, 1, 0, "\x00\x00\x00\x01video"),
+		ebmlElement(mkvBlockGroup, mkvTestBlock(mkvBlock, 2, 0, "<i>Hello</i> there."), ebmlUintElement(mkvBlockDuration, 1500)),
+		ebmlElement(mkvBlockGroup, mkvTestBlock(mkvBlock, 3, 0, `0,0,Default,,0,0,0,,{\i1}こんにちは\Nみなさん`), ebmlUintElement(mkvBlockDuration, 1500)),
+		mkvTestBlock(mkvSimpleBlock, 4, 500, "EXIT"),
+		mkvTestBlock(mkvSimpleBlock, 2, 2000, "Where are you going?"),
+	)
+	data := append(ebmlElement(0x1A45DFA3, ebmlElement(0x4282, []byte("matroska"))),
+		ebmlElement(mkvSegment, append(append(ebmlElement(mkvInfo, ebmlUintElement(mkvTimecodeScale, 1000000)), tracks...),
+			append(cluster, bytes.Join(extra, nil)...)...))...)
+	mkvpath := filepath.Join(t.TempDir(), "Movie.mkv")
+	if werr := ioutil.WriteFile(mkvpath, data, 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	return mkvpath
+}
+
+func TestChooseMkvTrack(t *testing.T) {
+	keepFlags(t)
+	defer func(track int) { mkvtrack = track }(mkvtrack)
+	tracks, _, perr := parseMkv(writeTestMkv(t), 0)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	tests := []struct {
+		lang  string
+		track int
+		want  uint64
+	}{
+		{"en", 0, 2},
+		{"ja", 0, 3},
+		{"fr", 0, 2},
+		{"en", 4, 4},
+		{"en", 1, 1},
+		{"en", 9, 0},
+	}
+	for _, tt := range tests {
+		srclang, mkvtrack = tt.lang, tt.track
+		var got uint64
+		if track := chooseMkvTrack(tracks); track != nil {
+			got = track.Number
+		}
+		if got != tt.want {
+			t.Errorf("chooseMkvTrack with -srclang %s -track %d = %d, want %d", tt.lang, tt.track, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMkvSub(t *testing.T) {
+	keepFlags(t)
+	defer func(track int) { mkvtrack = track }(mkvtrack)
+	mkvpath := writeTestMkv(t)
+	tests := []struct {
+		track int
+		want  string
+	}{
+		{2, "1\n00:00:01,000 --> 00:00:02,500\nHello there.\n\n2\n00:00:03,000 --> 00:00:05,000\nWhere are you going?\n\n"},
+		{3, "1\n00:00:01,000 --> 00:00:02,500\nこんにちは\nみなさん\n\n"},
+		{4, "1\n00:00:01,500 --> 00:00:03,500\nEXIT\n\n"},
+	}
+	for _, tt := range tests {
+		mkvtrack = tt.track
+		got, eerr := extractMkvSub(mkvpath)
+		if eerr != nil {
+			t.Errorf("track %d: %v", tt.track, eerr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("track %d:\n got %q\nwant %q", tt.track, got, tt.want)
+		}
+	}
+}
+
+//损坏文件中超出文件长度的元素返回错误，不分配内存
+func TestParseMkvCorrupt(t *testing.T) {
+	huge := []byte{0x63, 0xA2, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
+	tests := []struct {
+		name  string
+		data  []byte
+		track uint64
+	}{
+		{"codec private", append(ebmlElement(mkvTracks, ebmlElement(mkvTrackEntry)), huge...), 0},
+		{"block", append(ebmlElement(mkvCluster, ebmlUintElement(mkvTimecode, 0)), 0xA3, 0x01, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x82, 0x00, 0x00, 0x80), 2},
+	}
+	for _, tt := range tests {
+		mkvpath := filepath.Join(t.TempDir(), "Movie.mkv")
+		data := append(ebmlElement(mkvTracks, ebmlElement(mkvTrackEntry, ebmlUintElement(mkvTrackNumber, 2), ebmlUintElement(mkvTrackType, mkvTypeSubtitle))), tt.data...)
+		if werr := ioutil.WriteFile(mkvpath, data, 0644); werr != nil {
+			t.Fatal(werr)
+		}
+		if _, _, perr := parseMkv(mkvpath, tt.track); perr == nil || !strings.Contains(perr.Error(), "exceeds the file") {
+			t.Errorf("%s: error %v, want the size to be rejected", tt.name, perr)
+		}
+	}
+	//截断在其它轨道的数据块中时正常结束
+	video := mkvTestBlock(mkvSimpleBlock, 1, 0, "video")
+	if _, cues, perr := parseMkv(writeTestMkv(t, video[0:len(video)-2]), 2); perr != nil || len(cues) != 2 {
+		t.Errorf("truncated file: %d cues, error %v", len(cues), perr)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//输出文件类型
+const (
+	typeSrt  = "srt"
+	typeTxt  = "txt"
+	typeJson = "json"
+)
+
+//确定输出文件名：-o 参数优先，输入为标准输入时输出到标准输出，
+//否则按 -name -outdir 参数及默认文件名确定
+func outFileName(inpath, defpath, lang, ftype string) string {
+	if len(outpath) > 0 {
+		return outpath
+	}
+	if inpath == "-" {
+		return "-"
+	}
+	return templateName(inpath, defpath, lang, ftype)
+}
+
+//按文件名模板 -name 及输出目录 -outdir 确定文件名，未设置时使用默认文件名 defpath
+//模板参数 {base} 原文件名(不含.srt .json等扩展名) {lang} 语言标记 {type} 文件类型
+func templateName(inpath, defpath, lang, ftype string) string {
+	name := defpath
+	if len(nametemplate) > 0 && inpath != "-" {
+		r := strings.NewReplacer("{base}", subBaseName(inpath), "{lang}", lang, "{type}", ftype)
+		name = filepath.Join(filepath.Dir(inpath), r.Replace(nametemplate))
+	}
+	if len(outdir) > 0 {
+		mkerr := os.MkdirAll(outdir, 0755)
+		checkError(mkerr)
+		name = filepath.Join(outdir, filepath.Base(name))
+	}
+	return name
+}
+
+//去掉本软件使用的扩展名：Movie.srt.json -> Movie  Movie.chs.srt -> Movie
+func subBaseName(inpath string) string {
+	base := filepath.Base(inpath)
+	for {
+		ext := strings.ToLower(filepath.Ext(base))
+		switch ext {
+		case ".srt", ".json", ".txt", ".en", ".chs", ".cht", ".mkv", ".mks", ".webm":
+			base = base[0 : len(base)-len(ext)]
+			continue
+		}
+		return base
+	}
+}
+
+//语言代码对应的语言标记，供媒体服务器识别：zh -> zh-Hans
+func langTag(lang string) string {
+	switch strings.ToLower(lang) {
+	case "zh", "chs", "zh-cn", "zh-sg", "zh-hans":
+		return "zh-Hans"
+	case "cht", "zh-tw", "zh-hk", "zh-hant":
+		return "zh-Hant"
+	}
+	return lang
+}
+
+//已存在的文件未使用 -force 参数时不覆盖，由调用方提示错误并以非零退出码结束
+func checkOverwrite(filename string) error {
+	if filename == "-" || bforce {
+		return nil
+	}
+	if _, serr := os.Stat(filename); serr != nil {
+		return nil
+	}
+	if slang == "en" {
+		return errors.New("The file already exists and was not overwritten:" + filename + "\n" +
+			"Use -force to overwrite it, or -o -outdir -name to choose another file name.")
+	}
+	return errors.New("文件已存在，未覆盖:" + filename + "\n" + "使用-force参数覆盖，或使用-o -outdir -name参数指定其它文件名.")
+}
+
+//辅助json文件未包含译文时(第一步生成)可直接更新，否则需要 -force 参数
+func checkJsonOverwrite(jspath string) error {
+	if jspath == "-" || bforce {
+		return nil
+	}
+	if _, serr := os.Stat(jspath); serr != nil {
+		return nil
+	}
+	//无法读取的json文件也需要 -force 参数
+	if project, _, perr := loadProject(jspath); perr != nil || project.translated() {
+		return checkOverwrite(jspath)
+	}
+	return nil
+}
+
+//尚未改名为目标文件的临时文件，出错退出时删除
+var (
+	tempMu    sync.Mutex
+	tempFiles = make(map[string]bool)
+)
+
+//先写入同目录下的临时文件
+func createTempFile(filename string) (*os.File, error) {
+	file, terr := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if terr != nil {
+		return nil, terr
+	}
+	tempMu.Lock()
+	tempFiles[file.Name()] = true
+	tempMu.Unlock()
+	return file, nil
+}
+
+//临时文件写入完成后改名为目标文件，os.Rename 直接替换已存在的目标文件，不会留下不完整的文件
+func renameTempFile(tmpname, filename string) error {
+	tempMu.Lock()
+	delete(tempFiles, tmpname)
+	tempMu.Unlock()
+	if cerr := os.Chmod(tmpname, 0644); cerr != nil {
+		os.Remove(tmpname)
+		return cerr
+	}
+	if rerr := os.Rename(tmpname, filename); rerr != nil {
+		os.Remove(tmpname)
+		return rerr
+	}
+	return nil
+}
+
+//输出出错时删除未完成的临时文件，提示错误并以非零退出码结束
+func checkOutput(oerr error) {
+	if oerr == nil {
+		return
+	}
+	tempMu.Lock()
+	for name := range tempFiles {
+		os.Remove(name)
+	}
+	tempMu.Unlock()
+	fmt.Fprintln(os.Stderr, oerr.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubBaseName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"Movie.srt", "Movie"},
+		{"dir/Movie.srt.json", "Movie"},
+		{"Movie.chs.srt", "Movie"},
+		{"Movie.srt.en.txt", "Movie"},
+		{"Movie.mkv.json", "Movie"},
+		{"Movie.S01E01.srt", "Movie.S01E01"},
+		{"Movie", "Movie"},
+	}
+	for _, tt := range tests {
+		if got := subBaseName(tt.path); got != tt.want {
+			t.Errorf("subBaseName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateName(t *testing.T) {
+	defer func(name, dir string) { nametemplate, outdir = name, dir }(nametemplate, outdir)
+	tmp := t.TempDir()
+	tests := []struct {
+		template string
+		dir      string
+		want     string
+	}{
+		{"", "", filepath.Join("in", "Movie.chs.srt")},
+		{"{base}.{lang}.{type}", "", filepath.Join("in", "Movie.zh-Hans.srt")},
+		{"", tmp, filepath.Join(tmp, "Movie.chs.srt")},
+		{"{base}.{lang}.{type}", tmp, filepath.Join(tmp, "Movie.zh-Hans.srt")},
+	}
+	for _, tt := range tests {
+		nametemplate, outdir = tt.template, tt.dir
+		got := templateName(filepath.Join("in", "Movie.srt"), filepath.Join("in", "Movie.chs.srt"), langTag("zh"), typeSrt)
+		if got != tt.want {
+			t.Errorf("templateName with -name %q -outdir %q = %q, want %q", tt.template, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOverwrite(t *testing.T) {
+	defer func(force bool) { bforce = force }(bforce)
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "Movie.chs.srt")
+	if werr := ioutil.WriteFile(existing, []byte("1\n"), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	tests := []struct {
+		name    string
+		force   bool
+		wanterr bool
+	}{
+		{existing, false, true},
+		{existing, true, false},
+		{filepath.Join(dir, "new.srt"), false, false},
+		{"-", false, false},
+	}
+	for _, tt := range tests {
+		bforce = tt.force
+		if oerr := checkOverwrite(tt.name); (oerr != nil) != tt.wanterr {
+			t.Errorf("checkOverwrite(%q) with -force=%v: error %v, want error %v", tt.name, tt.force, oerr, tt.wanterr)
+		}
+	}
+}
+
+//改名替换已存在的文件，不留下临时文件
+func TestRenameTempFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "Movie.chs.srt")
+	if werr := ioutil.WriteFile(target, []byte("old"), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	tmpfile, terr := createTempFile(target)
+	if terr != nil {
+		t.Fatal(terr)
+	}
+	tmpfile.WriteString("new")
+	tmpfile.Close()
+	if rerr := renameTempFile(tmpfile.Name(), target); rerr != nil {
+		t.Fatal(rerr)
+	}
+	data, _ := ioutil.ReadFile(target)
+	if string(data) != "new" {
+		t.Errorf("target contains %q, want %q", data, "new")
+	}
+	if _, serr := os.Stat(tmpfile.Name()); !os.IsNotExist(serr) {
+		t.Errorf("temp file %s was left behind", tmpfile.Name())
+	}
+	if tempFiles[tmpfile.Name()] {
+		t.Errorf("temp file %s is still pending", tmpfile.Name())
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Gettext PO，每句字幕为一个条目，msgctxt 为句子序号及时间轴，
+//各行字幕及前后句原文写入注释
+var poFormat = exchangeFormat{
+	Name:   "PO",
+	Export: func(p *subProject) ([]byte, error) { return exportPo(p, false), nil },
+	Import: importPo,
+}
+
+//POT模板，不包含译文
+var potFormat = exchangeFormat{
+	Name:   "POT",
+	Export: func(p *subProject) ([]byte, error) { return exportPo(p, true), nil },
+	Import: importPo,
+}
+
+func poQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+	return `"` + s + `"`
+}
+
+func exportPo(p *subProject, template bool) []byte {
+	var b bytes.Buffer
+	lang := p.Languages.Target
+	if template {
+		lang = ""
+	}
+	b.WriteString("msgid \"\"\n")
+	b.WriteString("msgstr \"\"\n")
+	b.WriteString(poQuote("Project-Id-Version: "+p.Source.File+"\n") + "\n")
+	b.WriteString(poQuote("Language: "+lang+"\n") + "\n")
+	b.WriteString(poQuote("MIME-Version: 1.0\n") + "\n")
+	b.WriteString(poQuote("Content-Type: text/plain; charset=UTF-8\n") + "\n")
+	b.WriteString(poQuote("Content-Transfer-Encoding: 8bit\n") + "\n")
+	b.WriteString(poQuote("X-Generator: "+toolVersion+"\n") + "\n")
+	b.WriteString(poQuote("X-Source-Language: "+p.Languages.Source+"\n") + "\n")
+
+	subs := p.subs()
+	for i, sub := range subs {
+		if len(sub.SplitInfo) == 0 {
+			continue
+		}
+		b.WriteString("\n")
+		//前后句原文及各行字幕
+		if i > 0 {
+			b.WriteString("#. Previous: " + strings.TrimSpace(subs[i-1].DESub) + "\n")
+		}
+		if i+1 < len(subs) && len(subs[i+1].SplitInfo) > 0 {
+			b.WriteString("#. Next: " + strings.TrimSpace(subs[i+1].DESub) + "\n")
+		}
+		for _, part := range sub.SplitInfo {
+			b.WriteString("#. [" + part.STime + "] " + part.SSub + "\n")
+		}
+		b.WriteString("#: " + p.Source.File + ":" + strconv.Itoa(sub.SplitInfo[0].SPos) + "\n")
+		//机器翻译的译文待译者确认
+		if !template && machineTranslated(sub) {
+			b.WriteString("#, fuzzy\n")
+		}
+		b.WriteString("msgctxt " + poQuote(poContext(sub)) + "\n")
+		b.WriteString("msgid " + poQuote(strings.TrimSpace(sub.DESub)) + "\n")
+		if template {
+			b.WriteString("msgstr \"\"\n")
+		} else {
+			b.WriteString("msgstr " + poQuote(sub.DCSub) + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+//句子序号及时间轴：cue-2 00:00:03,000 --> 00:00:06,000
+func poContext(sub subInfo) string {
+	first := sub.SplitInfo[0].STime
+	last := sub.SplitInfo[len(sub.SplitInfo)-1].STime
+	timeline := first
+	if i, j := strings.Index(first, " --> "), strings.Index(last, " --> "); i > 0 && j > 0 {
+		timeline = first[0:i] + last[j:]
+	}
+	return "cue-" + strconv.Itoa(sub.DPos) + " " + timeline
+}
+
+//解析引号内的字符串
+func poUnquote(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", errors.New("invalid string " + s)
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+type poEntry struct {
+	line    int
+	fuzzy   bool
+	msgctxt string
+	msgid   string
+	msgstr  string
+	//当前读取的字段
+	field *string
+}
+
+func importPo(data []byte) ([]exchangeUnit, error) {
+	var units []exchangeUnit
+	entry := &poEntry{}
+
+	finish := func() error {
+		defer func() { entry = &poEntry{} }()
+		if entry.field == nil || len(entry.msgid) == 0 {
+			//头部条目及空条目
+			return nil
+		}
+		pos, perr := strconv.Atoi(strings.TrimPrefix(strings.Fields(entry.msgctxt + " x")[0], "cue-"))
+		if perr != nil {
+			return errors.New("line " + strconv.Itoa(entry.line) + ": msgctxt \"" + entry.msgctxt + "\" is not a TrSubtitle sentence")
+		}
+		units = append(units, exchangeUnit{Pos: pos, Translation: strings.TrimSpace(entry.msgstr), Fuzzy: entry.fuzzy})
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		var value string
+		var field *string
+		switch {
+		case len(line) == 0:
+			if ferr := finish(); ferr != nil {
+				return nil, ferr
+			}
+			continue
+		case strings.HasPrefix(line, "#~"):
+			//已废弃的条目
+			continue
+		case strings.HasPrefix(line, "#,"):
+			if entry.field != nil {
+				if ferr := finish(); ferr != nil {
+					return nil, ferr
+				}
+			}
+			for _, flag := range strings.Split(line[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					entry.fuzzy = true
+				}
+			}
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, `"`):
+			if entry.field == nil {
+				return nil, errors.New("line " + strconv.Itoa(lineno) + ": string without msgid or msgstr")
+			}
+			text, qerr := poUnquote(line)
+			if qerr != nil {
+				return nil, errors.New("line " + strconv.Itoa(lineno) + ": " + qerr.Error())
+			}
+			*entry.field += text
+			continue
+		case strings.HasPrefix(line, "msgctxt "):
+			//新条目
+			if entry.field != nil && entry.field != &entry.msgctxt {
+				if ferr := finish(); ferr != nil {
+					return nil, ferr
+				}
+			}
+			field, value = &entry.msgctxt, line[len("msgctxt "):]
+		case strings.HasPrefix(line, "msgid_plural "):
+			field, value = new(string), line[len("msgid_plural "):]
+		case strings.HasPrefix(line, "msgid "):
+			if entry.field == &entry.msgstr {
+				if ferr := finish(); ferr != nil {
+					return nil, ferr
+				}
+			}
+			field, value = &entry.msgid, line[len("msgid "):]
+		case strings.HasPrefix(line, "msgstr[0] "):
+			field, value = &entry.msgstr, line[len("msgstr[0] "):]
+		case strings.HasPrefix(line, "msgstr["):
+			field, value = new(string), line[strings.Index(line, "]")+1:]
+		case strings.HasPrefix(line, "msgstr "):
+			field, value = &entry.msgstr, line[len("msgstr "):]
+		default:
+			return nil, errors.New("line " + strconv.Itoa(lineno) + ": unknown keyword: " + line)
+		}
+		text, qerr := poUnquote(value)
+		if qerr != nil {
+			return nil, errors.New("line " + strconv.Itoa(lineno) + ": " + qerr.Error())
+		}
+		if entry.line == 0 {
+			entry.line = lineno
+		}
+		entry.field = field
+		*field = text
+	}
+	if ferr := finish(); ferr != nil {
+		return nil, ferr
+	}
+	return units, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+//导出的PO文件导入后得到相同的译文，机器翻译标记为待确认
+func TestPoRoundTrip(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		status      string
+		translation string
+		fuzzy       bool
+	}{
+		{"", "你好。", true},
+		{"mt", "你好。", true},
+		{"post-edited", "\"你好\"\n再见", false},
+		{"reviewed", "你好。", false},
+		{"approved", "你好。", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		subs := testSubs()
+		subs[0].DCSub, subs[0].Flow.Status = tt.translation, tt.status
+		p := newProject("Movie.srt", subs)
+		for _, template := range []bool{false, true} {
+			data := exportPo(p, template)
+			units, ierr := importPo(data)
+			if ierr != nil {
+				t.Fatalf("status %q: %v\n%s", tt.status, ierr, data)
+			}
+			if len(units) != 2 || units[0].Pos != 1 || units[1].Pos != 2 {
+				t.Fatalf("status %q: units %+v", tt.status, units)
+			}
+			want, fuzzy := tt.translation, tt.fuzzy
+			if template {
+				want, fuzzy = "", false
+			}
+			if units[0].Translation != want || units[0].Fuzzy != fuzzy {
+				t.Errorf("status %q template %v: imported %q fuzzy %v, want %q fuzzy %v",
+					tt.status, template, units[0].Translation, units[0].Fuzzy, want, fuzzy)
+			}
+			if !template && (units[1].Translation != "你要去哪里？" || !units[1].Fuzzy) {
+				t.Errorf("status %q: second sentence %+v", tt.status, units[1])
+			}
+		}
+	}
+}
+
+func TestImportPoErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"msgctxt \"line-1\"\nmsgid \"Hello\"\nmsgstr \"你好\"\n", "not a TrSubtitle sentence"},
+		{"\"orphan\"\n", "string without msgid"},
+		{"msgid \"Hello\nmsgstr \"\"\n", "invalid string"},
+		{"msgid \"\"\nmsgval \"\"\n", "unknown keyword"},
+	}
+	for _, tt := range tests {
+		if _, ierr := importPo([]byte(tt.data)); ierr == nil || !strings.Contains(ierr.Error(), tt.want) {
+			t.Errorf("importPo(%q): error %v, want %q", tt.data, ierr, tt.want)
+		}
+	}
+}
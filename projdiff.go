@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//冲突标记，与git相同
+const (
+	conflictStart = "<<<<<<< "
+	conflictSep   = "======="
+	conflictEnd   = ">>>>>>> "
+)
+
+//按句子序号查找
+func cueIndex(p *subProject) map[int]int {
+	index := make(map[int]int)
+	for i, cue := range p.Cues {
+		index[cue.Pos] = i
+	}
+	return index
+}
+
+//两个文本不同时输出 - +
+func diffField(b *strings.Builder, name, a, c string) bool {
+	if a == c {
+		return false
+	}
+	b.WriteString("  " + name + ":\n")
+	b.WriteString("  - " + strings.Replace(a, "\n", "\n    ", -1) + "\n")
+	b.WriteString("  + " + strings.Replace(c, "\n", "\n    ", -1) + "\n")
+	return true
+}
+
+//比较两句字幕的译文、状态及各行时间轴和译文
+func diffCue(a, c projectCue) string {
+	var b strings.Builder
+	diffField(&b, "translation", a.Translation, c.Translation)
+	diffField(&b, "status", flowText(a.workflow), flowText(c.workflow))
+	diffField(&b, "comments", strings.Join(commentLines("", a.workflow), "\n"), strings.Join(commentLines("", c.workflow), "\n"))
+	if len(a.Lines) != len(c.Lines) {
+		b.WriteString("  lines: " + strconv.Itoa(len(a.Lines)) + " -> " + strconv.Itoa(len(c.Lines)) + "\n")
+		return b.String()
+	}
+	for k := range a.Lines {
+		line := "line " + strconv.Itoa(a.Lines[k].Pos+1)
+		diffField(&b, line+" time", a.Lines[k].Time, c.Lines[k].Time)
+		diffField(&b, line, a.Lines[k].Translation, c.Lines[k].Translation)
+	}
+	return b.String()
+}
+
+//逐句比较 -jsfile 与 -diff 指定的两个项目文件
+func DiffProjects() {
+	checkJsonFile()
+	pa := readProject(josnfilepath)
+	pc := readProject(diffpath)
+	if len(pa.Source.SHA1) > 0 && len(pc.Source.SHA1) > 0 && pa.Source.SHA1 != pc.Source.SHA1 {
+		printWarning("The json files were created from different original subtitles.",
+			"两个json文件由不同的原文字幕生成.")
+	}
+
+	var b strings.Builder
+	b.WriteString("--- " + josnfilepath + "\n")
+	b.WriteString("+++ " + diffpath + "\n")
+	changed := 0
+	cindex := cueIndex(pc)
+	for _, cue := range pa.Cues {
+		i, ok := cindex[cue.Pos]
+		if !ok {
+			b.WriteString("\ncue " + strconv.Itoa(cue.Pos) + ": only in " + josnfilepath + "\n")
+			changed++
+			continue
+		}
+		if text := diffCue(cue, pc.Cues[i]); len(text) > 0 {
+			b.WriteString("\ncue " + strconv.Itoa(cue.Pos) + ": " + strings.TrimSpace(cue.Original) + "\n")
+			b.WriteString(text)
+			changed++
+		}
+	}
+	aindex := cueIndex(pa)
+	for _, cue := range pc.Cues {
+		if _, ok := aindex[cue.Pos]; !ok {
+			b.WriteString("\ncue " + strconv.Itoa(cue.Pos) + ": only in " + diffpath + "\n")
+			changed++
+		}
+	}
+
+	if changed > 0 {
+		_, werr := os.Stdout.WriteString(b.String())
+		checkError(werr)
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, strconv.Itoa(changed)+" of "+strconv.Itoa(len(pa.Cues))+" sentences differ.")
+	} else {
+		fmt.Fprintln(os.Stderr, "共 "+strconv.Itoa(len(pa.Cues))+" 句，其中 "+strconv.Itoa(changed)+" 句不同.")
+	}
+}
+
+//三方合并一个字段：仅一方修改时取修改后的内容，双方修改不同时返回冲突
+func merge3(base, ours, theirs string) (string, bool) {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, true
+	case ours == base:
+		return theirs, true
+	}
+	return ours, false
+}
+
+//冲突内容，双方内容以标记分隔
+func conflictText(ours, theirs, ourname, theirname string) string {
+	return conflictStart + ourname + "\n" + ours + "\n" + conflictSep + "\n" + theirs + "\n" + conflictEnd + theirname
+}
+
+//合并一句字幕，返回合并结果、冲突的字段及双方修改不同的时间轴
+//时间轴不写入冲突标记(无法生成字幕)，保留本方的时间轴
+func mergeCue(base, ours, theirs projectCue, ourname, theirname string) (projectCue, []string, []string) {
+	var conflicts, timeconflicts []string
+	merged := ours
+	merged.Lines = append([]projectLine{}, ours.Lines...)
+
+	//译文摘要跟随整句译文，冲突时保留本方摘要，解决冲突后 -resplit 重新切分
+	if text, ok := merge3(base.Translation, ours.Translation, theirs.Translation); ok {
+		merged.Translation = text
+		if text != ours.Translation {
+			merged.TranslationHash = theirs.TranslationHash
+		}
+	} else {
+		merged.Translation = conflictText(ours.Translation, theirs.Translation, ourname, theirname)
+		conflicts = append(conflicts, "translation")
+	}
+
+	if len(base.Lines) != len(ours.Lines) || len(base.Lines) != len(theirs.Lines) {
+		merged.workflow = mergeFlow(base.workflow, ours.workflow, theirs.workflow, false)
+		conflicts = append(conflicts, "lines "+strconv.Itoa(len(ours.Lines))+" / "+strconv.Itoa(len(theirs.Lines)))
+		return merged, conflicts, nil
+	}
+	changed := merged.Translation != ours.Translation
+	for k := range merged.Lines {
+		line := "line " + strconv.Itoa(ours.Lines[k].Pos+1)
+		time, ok := merge3(base.Lines[k].Time, ours.Lines[k].Time, theirs.Lines[k].Time)
+		merged.Lines[k].Time = time
+		if !ok {
+			timeconflicts = append(timeconflicts, line+" "+ours.Lines[k].Time+" / "+theirs.Lines[k].Time)
+		}
+		if text, ok := merge3(base.Lines[k].Translation, ours.Lines[k].Translation, theirs.Lines[k].Translation); ok {
+			merged.Lines[k].Translation = text
+		} else {
+			merged.Lines[k].Translation = conflictText(ours.Lines[k].Translation, theirs.Lines[k].Translation, ourname, theirname)
+			conflicts = append(conflicts, line)
+		}
+		linechanged := merged.Lines[k].Translation != ours.Lines[k].Translation
+		merged.Lines[k].workflow = mergeFlow(base.Lines[k].workflow, ours.Lines[k].workflow, theirs.Lines[k].workflow, linechanged)
+		changed = changed || linechanged
+	}
+	merged.workflow = mergeFlow(base.workflow, ours.workflow, theirs.workflow, changed)
+	return merged, conflicts, timeconflicts
+}
+
+//是否包含未解决的冲突标记
+func hasConflict(p *subProject) bool {
+	for _, cue := range p.Cues {
+		if strings.Contains(cue.Translation, conflictStart) {
+			return true
+		}
+		for _, line := range cue.Lines {
+			if strings.Contains(line.Translation, conflictStart) || strings.Contains(line.Time, conflictStart) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//以 -base 为共同的原始文件，将 -merge 文件的修改合并到 -jsfile 文件
+//合并结果保存到 -jsout 或 -jsfile，无冲突时生成字幕
+func MergeProjects() {
+	checkJsonFile()
+	if len(basepath) == 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "-merge requires -base, the json file both copies were made from.")
+		} else {
+			fmt.Fprintln(os.Stderr, "-merge 需要 -base 参数指定双方修改前的原始json文件.")
+		}
+		os.Exit(1)
+	}
+	ours := readProject(josnfilepath)
+	theirs := readProject(mergepath)
+	base := readProject(basepath)
+	ourname, theirname := filepath.Base(josnfilepath), filepath.Base(mergepath)
+
+	bindex, tindex := cueIndex(base), cueIndex(theirs)
+	var report, timereport, skipped []string
+	merged, conflicted := 0, 0
+	for i, cue := range ours.Cues {
+		bi, bok := bindex[cue.Pos]
+		ti, tok := tindex[cue.Pos]
+		if !bok || !tok {
+			skipped = append(skipped, strconv.Itoa(cue.Pos))
+			continue
+		}
+		result, conflicts, timeconflicts := mergeCue(base.Cues[bi], cue, theirs.Cues[ti], ourname, theirname)
+		if len(conflicts) > 0 {
+			report = append(report, "cue "+strconv.Itoa(cue.Pos)+": "+strings.Join(conflicts, ", "))
+			conflicted++
+		}
+		if len(timeconflicts) > 0 {
+			timereport = append(timereport, "cue "+strconv.Itoa(cue.Pos)+": "+strings.Join(timeconflicts, ", "))
+		}
+		if diffCue(cue, result) != "" {
+			merged++
+		}
+		ours.Cues[i] = result
+	}
+	if len(skipped) > 0 {
+		printWarning("Sentences missing from -merge or -base were kept unchanged: "+joinPos(skipped),
+			"-merge 或 -base 中没有以下句子，保持不变: "+joinPos(skipped))
+	}
+
+	if len(timereport) > 0 {
+		printWarning(strconv.Itoa(len(timereport))+" sentences have timings changed differently in both files, the timings of "+
+			ourname+" were kept:", strconv.Itoa(len(timereport))+" 句的时间轴在两个文件中的修改不同，保留 "+ourname+" 的时间轴:")
+		fmt.Fprintln(os.Stderr, strings.Join(timereport, "\n"))
+	}
+
+	outjs := josnfilepath
+	if len(jsoutpath) > 0 {
+		outjs = jsoutpath
+	}
+	//先保存合并结果，字幕文件不能生成(如已存在)时不丢失合并的修改
+	saveProject(outjs, ours)
+
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Merged "+strconv.Itoa(merged)+" sentences changed in "+mergepath+" into "+outjs+".")
+	} else {
+		fmt.Fprintln(os.Stderr, "已将 "+mergepath+" 中修改的 "+strconv.Itoa(merged)+" 句合并到 "+outjs+".")
+	}
+	if conflicted > 0 {
+		printWarning(strconv.Itoa(conflicted)+" sentences were changed differently in both files, "+
+			"please resolve the conflict markers in "+outjs+" , then run -jsfile "+outjs+" -resplit:",
+			strconv.Itoa(conflicted)+" 句在两个文件中的修改不同，请解决 "+outjs+" 中的冲突标记，然后使用 -jsfile "+outjs+" -resplit:")
+		fmt.Fprintln(os.Stderr, strings.Join(report, "\n")+"\n")
+		return
+	}
+	if outjs == "-" {
+		return
+	}
+	//无冲突时由合并结果生成字幕，按保存的json文件命名(Merged.srt.json -> Merged.chs.srt)
+	//不能由其确定字幕文件名时(如 m.json)按 -jsfile 命名，-o -outdir -name 参数同样适用
+	if strings.HasSuffix(jsonChsFileName(outjs), ".srt") || josnfilepath == "-" {
+		josnfilepath = outjs
+	}
+	checkOutput(renderProject(ours))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		base, ours, theirs string
+		want               string
+		ok                 bool
+	}{
+		{"a", "a", "a", "a", true},
+		{"a", "b", "a", "b", true},
+		{"a", "a", "c", "c", true},
+		{"a", "b", "b", "b", true},
+		{"a", "b", "c", "b", false},
+	}
+	for _, tt := range tests {
+		if got, ok := merge3(tt.base, tt.ours, tt.theirs); got != tt.want || ok != tt.ok {
+			t.Errorf("merge3(%q, %q, %q) = %q, %v, want %q, %v", tt.base, tt.ours, tt.theirs, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMergeCue(t *testing.T) {
+	base := newProject("-", testSubs()).Cues[1]
+	edit := func(translation, line, time string) projectCue {
+		cue := base
+		cue.Lines = append([]projectLine{}, base.Lines...)
+		if len(translation) > 0 {
+			cue.Translation = translation
+		}
+		if len(line) > 0 {
+			cue.Lines[1].Translation = line
+		}
+		if len(time) > 0 {
+			cue.Lines[1].Time = time
+		}
+		return cue
+	}
+	tests := []struct {
+		name        string
+		ours        projectCue
+		theirs      projectCue
+		translation string
+		line        string
+		conflicts   string
+	}{
+		{"unchanged", base, base, "你要去哪里？", "去哪里？", ""},
+		{"theirs", base, edit("你去哪儿？", "去哪儿？", ""), "你去哪儿？", "去哪儿？", ""},
+		{"both", edit("", "去哪儿？", ""), edit("", "", "00:00:04,000 --> 00:00:05,500"), "你要去哪里？", "去哪儿？", ""},
+		{"same", edit("你去哪儿？", "", ""), edit("你去哪儿？", "", ""), "你去哪儿？", "去哪里？", ""},
+		{"conflict", edit("你去哪儿？", "去哪儿？", ""), edit("你要去哪？", "去哪？", ""),
+			conflictText("你去哪儿？", "你要去哪？", "a", "b"), conflictText("去哪儿？", "去哪？", "a", "b"), "translation, line 4"},
+	}
+	for _, tt := range tests {
+		merged, conflicts, _ := mergeCue(base, tt.ours, tt.theirs, "a", "b")
+		if merged.Translation != tt.translation || merged.Lines[1].Translation != tt.line {
+			t.Errorf("%s: merged %q / %q, want %q / %q", tt.name, merged.Translation, merged.Lines[1].Translation, tt.translation, tt.line)
+		}
+		if got := strings.Join(conflicts, ", "); got != tt.conflicts {
+			t.Errorf("%s: conflicts %q, want %q", tt.name, got, tt.conflicts)
+		}
+	}
+	//行数不同时整句冲突
+	split := base
+	split.Lines = base.Lines[0:1]
+	if _, conflicts, _ := mergeCue(base, base, split, "a", "b"); len(conflicts) != 1 || conflicts[0] != "lines 2 / 1" {
+		t.Errorf("line count: conflicts %q", conflicts)
+	}
+	//时间轴双方修改不同时保留本方的时间轴，单独列出
+	ours, theirs := edit("", "", "00:00:04,000 --> 00:00:05,500"), edit("", "", "00:00:04,200 --> 00:00:05,000")
+	merged, conflicts, timeconflicts := mergeCue(base, ours, theirs, "a", "b")
+	if merged.Lines[1].Time != ours.Lines[1].Time || len(conflicts) != 0 ||
+		strings.Join(timeconflicts, ", ") != "line 4 00:00:04,000 --> 00:00:05,500 / 00:00:04,200 --> 00:00:05,000" {
+		t.Errorf("timing: merged %q conflicts %q timings %q", merged.Lines[1].Time, conflicts, timeconflicts)
+	}
+}
+
+//无冲突的合并结果保存到 -jsout 并由合并结果生成字幕，-jsout 不能确定字幕文件名时按 -jsfile 命名
+func TestMergeProjects(t *testing.T) {
+	keepFlags(t)
+	defer func(merge, base string) { mergepath, basepath = merge, base }(mergepath, basepath)
+	tests := []struct {
+		jsout  string
+		fromjs bool
+	}{
+		{"Merged.srt.json", false},
+		{"m.json", true},
+	}
+	for _, tt := range tests {
+		basepath = writeTestProject(t, testSubs())
+		subs := testSubs()
+		subs[0].DCSub, subs[0].SplitInfo[0].SCSub = "您好。", "您好。"
+		josnfilepath = writeTestProject(t, subs)
+		subs = testSubs()
+		subs[1].DCSub, subs[1].SplitInfo[1].SCSub = "你要去哪儿？", "去哪儿？"
+		mergepath = writeTestProject(t, subs)
+		jsoutpath = filepath.Join(t.TempDir(), tt.jsout)
+		subpath := jsonChsFileName(jsoutpath)
+		if tt.fromjs {
+			subpath = jsonChsFileName(josnfilepath)
+		}
+
+		MergeProjects()
+
+		merged := readProject(jsoutpath).subs()
+		if merged[0].DCSub != "您好。" || merged[1].DCSub != "你要去哪儿？" || merged[1].SplitInfo[1].SCSub != "去哪儿？" {
+			t.Errorf("%s: merged %q %q", tt.jsout, merged[0].DCSub, merged[1].DCSub)
+		}
+		data, rerr := ioutil.ReadFile(subpath)
+		if rerr != nil || !strings.Contains(string(data), "您好。") || !strings.Contains(string(data), "去哪儿？") {
+			t.Errorf("%s: subtitle %q, error %v", tt.jsout, data, rerr)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//辅助json文件(项目文件)格式
+const (
+	projectFormat  = "trsubtitle-project"
+	projectVersion = 3
+	toolVersion    = "TrSubtitle/0.6"
+	//译文按原文各行的标点及长度比例切分
+	splitAlgorithm = "punct-ratio/1"
+)
+
+//项目文件：包含生成此文件的原文字幕、语言、切分方式及版本信息
+type subProject struct {
+	Format         string        `json:"format"`
+	Version        int           `json:"version"`
+	Tool           string        `json:"tool"`
+	Source         projectSource `json:"source"`
+	Languages      projectLangs  `json:"languages"`
+	SplitAlgorithm string        `json:"splitAlgorithm"`
+	Cues           []projectCue  `json:"cues"`
+
+	//原文字幕文件路径，保存到其它目录时重新计算相对路径
+	srcpath string
+	//由0.5版本文件转换时为原文件名，保存到原文件时先备份为 .bak
+	legacypath string
+}
+
+type projectSource struct {
+	//相对于项目文件所在目录的文件名
+	File  string `json:"file"`
+	SHA1  string `json:"sha1,omitempty"`
+	Track int    `json:"track,omitempty"`
+}
+
+type projectLangs struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+//一句字幕(可能包含多行)
+type projectCue struct {
+	Pos             int    `json:"pos"`
+	Original        string `json:"original"`
+	Translation     string `json:"translation"`
+	LineCount       int    `json:"lineCount"`
+	TranslationHash string `json:"translationHash,omitempty"`
+	Type            string `json:"type,omitempty"`
+	workflow
+	Lines []projectLine `json:"lines"`
+}
+
+type projectLine struct {
+	Pos         int    `json:"pos"`
+	Time        string `json:"time"`
+	Original    string `json:"original"`
+	Translation string `json:"translation"`
+	workflow
+	sdhInfo
+}
+
+//由原文字幕生成新的项目
+func newProject(srcpath string, subs []subInfo) *subProject {
+	p := &subProject{
+		Format:         projectFormat,
+		Version:        projectVersion,
+		Tool:           toolVersion,
+		Languages:      projectLangs{srclang, tglang},
+		SplitAlgorithm: splitAlgorithm,
+	}
+	if srcpath != "-" {
+		p.srcpath = srcpath
+		if isMkvFile(srcpath) {
+			p.Source.Track = mkvtrack
+		} else if data, rerr := ioutil.ReadFile(srcpath); rerr == nil {
+			p.Source.SHA1 = sourceHash(data)
+		}
+	}
+	//由译文生成的句子为机器翻译
+	for i := range subs {
+		if len(subs[i].DCSub) > 0 && len(subs[i].Flow.Status) == 0 {
+			subs[i].Flow.Status = "mt"
+		}
+	}
+	p.setSubs(subs)
+	return p
+}
+
+func sourceHash(data []byte) string {
+	return subHash(string(data))
+}
+
+func (p *subProject) subs() []subInfo {
+	subs := make([]subInfo, len(p.Cues))
+	for i, cue := range p.Cues {
+		subs[i] = subInfo{
+			DPos:   cue.Pos,
+			DCSub:  cue.Translation,
+			DESub:  cue.Original,
+			MNum:   cue.LineCount,
+			DCHash: cue.TranslationHash,
+			Type:   cue.Type,
+			Flow:   cue.workflow,
+		}
+		for _, line := range cue.Lines {
+			subs[i].SplitInfo = append(subs[i].SplitInfo, subpart{line.Pos, line.Time, line.Translation, line.Original, line.workflow, line.sdhInfo})
+		}
+	}
+	return subs
+}
+
+func (p *subProject) setSubs(subs []subInfo) {
+	p.Cues = make([]projectCue, len(subs))
+	for i, sub := range subs {
+		p.Cues[i] = projectCue{
+			Pos:             sub.DPos,
+			Original:        sub.DESub,
+			Translation:     sub.DCSub,
+			LineCount:       sub.MNum,
+			TranslationHash: sub.DCHash,
+			Type:            sub.Type,
+			workflow:        sub.Flow,
+			Lines:           []projectLine{},
+		}
+		for _, part := range sub.SplitInfo {
+			p.Cues[i].Lines = append(p.Cues[i].Lines, projectLine{part.SPos, part.STime, part.SSub, part.SCSub, part.Flow, part.SDH})
+		}
+	}
+}
+
+//是否已包含译文
+func (p *subProject) translated() bool {
+	for _, cue := range p.Cues {
+		if len(cue.Translation) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//读取项目文件，0.5版本的json文件(subInfo数组)转换为当前格式
+//migrated 为 true 时表示由旧版本文件转换
+func loadProject(jspath string) (p *subProject, migrated bool, err error) {
+	data, _, rerr := readTextFile(jspath)
+	if rerr != nil {
+		return nil, false, rerr
+	}
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var subs []subInfo
+		if jerr := json.Unmarshal(data, &subs); jerr != nil {
+			return nil, false, jsonError(data, jerr)
+		}
+		p = &subProject{
+			Format:         projectFormat,
+			Version:        projectVersion,
+			Tool:           "TrSubtitle/0.5",
+			Languages:      projectLangs{srclang, tglang},
+			SplitAlgorithm: splitAlgorithm,
+		}
+		//旧版本按文件名确定原文字幕：Movie.srt.json -> Movie.srt
+		if jspath != "-" && strings.HasSuffix(strings.ToLower(jspath), ".json") {
+			p.srcpath = jspath[0 : len(jspath)-5]
+			p.Source.File = filepath.Base(p.srcpath)
+		}
+		p.setSubs(subs)
+		return p, true, p.validate()
+	}
+
+	p = &subProject{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if jerr := decoder.Decode(p); jerr != nil {
+		return nil, false, jsonError(data, jerr)
+	}
+	if p.Format != projectFormat {
+		return nil, false, errors.New("not a TrSubtitle project file (format \"" + p.Format + "\")")
+	}
+	if p.Version < 1 || p.Version > projectVersion {
+		return nil, false, errors.New("project version " + strconv.Itoa(p.Version) +
+			" is not supported by " + toolVersion + " (supports up to " + strconv.Itoa(projectVersion) + ")")
+	}
+	if len(p.Source.File) > 0 && jspath != "-" {
+		p.srcpath = p.Source.File
+		if !filepath.IsAbs(p.srcpath) {
+			p.srcpath = filepath.Join(filepath.Dir(jspath), p.Source.File)
+		}
+	}
+	if verr := p.validate(); verr != nil {
+		return nil, false, verr
+	}
+	return p, false, nil
+}
+
+//json语法错误转换为行号及列号
+func jsonError(data []byte, jerr error) error {
+	var offset int64 = -1
+	switch e := jerr.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return jerr
+	}
+	line := bytes.Count(data[0:offset], []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndex(data[0:offset], []byte("\n"))
+	return errors.New("line " + strconv.Itoa(line) + ", column " + strconv.Itoa(column) + ": " + jerr.Error())
+}
+
+//检查各句字幕，最多列出10个错误
+func (p *subProject) validate() error {
+	var problems []string
+	add := func(i int, cue projectCue, msg string) {
+		if len(problems) < 10 {
+			problems = append(problems, "cue "+strconv.Itoa(i+1)+" (pos "+strconv.Itoa(cue.Pos)+"): "+msg)
+		}
+	}
+	lastpos := -1
+	for i, cue := range p.Cues {
+		if len(cue.Lines) == 0 && len(strings.TrimSpace(cue.Original)) > 0 {
+			add(i, cue, "no lines")
+			continue
+		}
+		if _, ok := workflowStatuses[cue.Status]; !ok && len(cue.Status) > 0 {
+			add(i, cue, "unknown status \""+cue.Status+"\" (mt post-edited reviewed approved)")
+		}
+		if !validCueType(cue.Type) && len(cue.Type) > 0 {
+			add(i, cue, "unknown type \""+cue.Type+"\" (lyric sign credit)")
+		}
+		if cue.LineCount != len(cue.Lines) {
+			add(i, cue, "lineCount "+strconv.Itoa(cue.LineCount)+" does not match "+strconv.Itoa(len(cue.Lines))+" lines")
+		}
+		for _, line := range cue.Lines {
+			if line.Pos <= lastpos {
+				add(i, cue, "line pos "+strconv.Itoa(line.Pos)+" is not in ascending order")
+			}
+			lastpos = line.Pos
+			if !subTimeReg.MatchString(line.Time) {
+				add(i, cue, "line "+strconv.Itoa(line.Pos)+" has an invalid time \""+line.Time+"\"")
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
+
+//读取项目文件，出错时提示并退出；旧版本文件只在内存中转换，由保存项目文件的命令写入当前格式
+func readProject(jspath string) *subProject {
+	p, migrated, perr := loadProject(jspath)
+	if perr != nil {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Invalid json file: "+jspath)
+		} else {
+			fmt.Fprintln(os.Stderr, "json文件格式错误: "+jspath)
+		}
+		fmt.Fprintln(os.Stderr, perr.Error())
+		os.Exit(1)
+	}
+	if migrated && jspath != "-" {
+		p.legacypath = jspath
+	}
+	return p
+}
+
+//原文字幕在生成项目文件后被修改时提示
+func checkProjectSource(p *subProject) {
+	if len(p.Source.SHA1) == 0 || len(p.srcpath) == 0 {
+		return
+	}
+	data, rerr := ioutil.ReadFile(p.srcpath)
+	if rerr != nil || sourceHash(data) == p.Source.SHA1 {
+		return
+	}
+	printWarning("The original subtitle has changed since the json file was created: "+p.srcpath,
+		"生成json文件后原文字幕已被修改: "+p.srcpath)
+}
+
+//保存项目文件，文件名为 - 时输出到标准输出
+func saveProject(jspath string, p *subProject) {
+	checkError(writeProject(jspath, p))
+}
+
+//写入项目文件并返回错误，网页审校等不能中止的调用使用
+func writeProject(jspath string, p *subProject) error {
+	if len(p.srcpath) > 0 {
+		p.Source.File = p.srcpath
+		if jspath != "-" {
+			absjs, jerr := filepath.Abs(filepath.Dir(jspath))
+			abssrc, serr := filepath.Abs(p.srcpath)
+			if jerr == nil && serr == nil {
+				if rel, rerr := filepath.Rel(absjs, abssrc); rerr == nil {
+					p.Source.File = filepath.ToSlash(rel)
+				}
+			}
+		}
+	}
+	p.Tool = toolVersion
+	p.Version = projectVersion
+
+	//不转义时间轴中的 -->，便于手工编辑
+	var jbuf bytes.Buffer
+	encoder := json.NewEncoder(&jbuf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if eerr := encoder.Encode(p); eerr != nil {
+		return eerr
+	}
+	jfile := jbuf.Bytes()
+	if jspath == "-" {
+		_, werr := os.Stdout.Write(jfile)
+		return werr
+	}
+	//覆盖0.5版本的原文件前先备份
+	if len(p.legacypath) > 0 && sameFile(p.legacypath, jspath) {
+		data, rerr := ioutil.ReadFile(jspath)
+		if rerr != nil {
+			return rerr
+		}
+		if werr := ioutil.WriteFile(jspath+".bak", data, 0644); werr != nil {
+			return werr
+		}
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "The 0.5 json file has been converted to the project format version "+
+				strconv.Itoa(projectVersion)+", the original file is saved as "+jspath+".bak")
+		} else {
+			fmt.Fprintln(os.Stderr, "0.5版本的json文件已转换为第"+strconv.Itoa(projectVersion)+
+				"版项目文件格式，原文件保存为 "+jspath+".bak")
+		}
+		p.legacypath = ""
+	}
+	tmpfile, terr := createTempFile(jspath)
+	if terr != nil {
+		return terr
+	}
+	_, werr := tmpfile.Write(jfile)
+	tmpfile.Close()
+	if werr != nil {
+		os.Remove(tmpfile.Name())
+		return werr
+	}
+	return renameTempFile(tmpfile.Name(), jspath)
+}
+
+func sameFile(a, b string) bool {
+	fa, aerr := os.Stat(a)
+	fb, berr := os.Stat(b)
+	return aerr == nil && berr == nil && os.SameFile(fa, fb)
+}
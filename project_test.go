@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//两句字幕，第二句切分为两行
+func testSubs() []subInfo {
+	subs := []subInfo{
+		{DPos: 1, DESub: "Hello there. \n", DCSub: "你好。", MNum: 1, SplitInfo: []subpart{
+			{SPos: 1, STime: "00:00:01,000 --> 00:00:02,500", SSub: "Hello there.", SCSub: "你好。"},
+		}},
+		{DPos: 2, DESub: "Where are you going? \n", DCSub: "你要去哪里？", MNum: 2, SplitInfo: []subpart{
+			{SPos: 2, STime: "00:00:03,000 --> 00:00:04,000", SSub: "Where are", SCSub: "你要"},
+			{SPos: 3, STime: "00:00:04,000 --> 00:00:05,000", SSub: "you going?", SCSub: "去哪里？"},
+		}},
+	}
+	for i := range subs {
+		subs[i].DCHash = subHash(subs[i].DCSub)
+	}
+	return subs
+}
+
+//在临时目录中保存项目文件，返回文件名
+func writeTestProject(t *testing.T, subs []subInfo) string {
+	t.Helper()
+	jspath := filepath.Join(t.TempDir(), "Movie.srt.json")
+	saveProject(jspath, newProject("-", subs))
+	return jspath
+}
+
+//测试中修改的全局参数，结束时恢复
+func keepFlags(t *testing.T) {
+	lang, stype, src, tg := slang, sstype, srclang, tglang
+	js, jsout, out, dir, name := josnfilepath, jsoutpath, outpath, outdir, nametemplate
+	force, final, conv, oenc, eol := bforce, bfinal, convmode, oencname, eolname
+	t.Cleanup(func() {
+		slang, sstype, srclang, tglang = lang, stype, src, tg
+		josnfilepath, jsoutpath, outpath, outdir, nametemplate = js, jsout, out, dir, name
+		bforce, bfinal, convmode, oencname, eolname = force, final, conv, oenc, eol
+		stdinRead = false
+	})
+	slang, sstype, srclang, tglang = "en", "b", "en", "zh"
+	stdinRead = false
+}
+
+func TestProjectSubs(t *testing.T) {
+	keepFlags(t)
+	subs := testSubs()
+	subs[1].Type = "lyric"
+	subs[1].SplitInfo[0].SDH = sdhInfo{Speaker: "JOHN", Sounds: []sdhSound{{Original: "[SIGHS]", Translation: "[叹气]"}}}
+	subs[1].SplitInfo[1].Flow.Comments = []subComment{{Author: "reviewer", Time: "2020-01-01T00:00:00Z", Text: "?"}}
+	got := readProject(writeTestProject(t, subs)).subs()
+	if !reflect.DeepEqual(got, subs) {
+		t.Errorf("project round trip:\n got %+v\nwant %+v", got, subs)
+	}
+}
+
+func TestLoadProjectErrors(t *testing.T) {
+	keepFlags(t)
+	valid, _ := ioutil.ReadFile(writeTestProject(t, testSubs()))
+	version := `"version": ` + strconv.Itoa(projectVersion)
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"syntax", "{\n\"format\": }", "line 2, column"},
+		{"unknown field", strings.Replace(string(valid), `"tool"`, `"tools"`, 1), "unknown field"},
+		{"format", strings.Replace(string(valid), projectFormat, "other", 1), "not a TrSubtitle project file"},
+		{"version", strings.Replace(string(valid), version, `"version": 99`, 1), "project version 99"},
+		{"time", strings.Replace(string(valid), "00:00:03,000 -->", "00:00:03 -->", 1), "invalid time"},
+		{"status", strings.Replace(string(valid), `"status": "mt"`, `"status": "done"`, 1), "unknown status"},
+		{"line count", strings.Replace(string(valid), `"lineCount": 2`, `"lineCount": 3`, 1), "lineCount 3"},
+	}
+	for _, tt := range tests {
+		jspath := filepath.Join(t.TempDir(), "Movie.srt.json")
+		if werr := ioutil.WriteFile(jspath, []byte(tt.data), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+		if _, _, lerr := loadProject(jspath); lerr == nil || !strings.Contains(lerr.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, lerr, tt.want)
+		}
+	}
+}
+
+//原文字幕能提取的时间轴，项目文件也能读取
+func TestProjectTimes(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		time  string
+		valid bool
+	}{
+		{"00:00:01,000 --> 00:00:02,000", true},
+		{"0:00:01,000 --> 0:00:02,000", true},
+		{"100:00:01,000 --> 100:00:02,000", true},
+		{"00:00:01,5 --> 00:00:02,25", true},
+		{"00:00:01.000 --> 00:00:02.000", false},
+		{"00:00:01,000 -> 00:00:02,000", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if extracted := subTimeReg.MatchString(tt.time); extracted != tt.valid {
+			t.Errorf("extraction of %q = %v, want %v", tt.time, extracted, tt.valid)
+		}
+		subs := testSubs()
+		subs[0].SplitInfo[0].STime = tt.time
+		p := newProject("-", subs)
+		if verr := p.validate(); (verr == nil) != tt.valid {
+			t.Errorf("validate %q: %v, want valid %v", tt.time, verr, tt.valid)
+		}
+	}
+}
+
+//0.5版本的文件只读时不修改，保存时备份并转换为当前格式
+func TestProjectMigration(t *testing.T) {
+	keepFlags(t)
+	jspath := filepath.Join(t.TempDir(), "Movie.srt.json")
+	old, _ := json.Marshal(testSubs())
+	if werr := ioutil.WriteFile(jspath, old, 0644); werr != nil {
+		t.Fatal(werr)
+	}
+
+	p := readProject(jspath)
+	if got := p.subs(); len(got) != 2 || got[1].SplitInfo[1].SCSub != "去哪里？" {
+		t.Errorf("migrated subs %+v", got)
+	}
+	if data, _ := ioutil.ReadFile(jspath); string(data) != string(old) {
+		t.Errorf("reading a 0.5 file changed it")
+	}
+	if _, serr := os.Stat(jspath + ".bak"); !os.IsNotExist(serr) {
+		t.Errorf("reading a 0.5 file wrote a backup")
+	}
+
+	saveProject(jspath, p)
+	if data, _ := ioutil.ReadFile(jspath + ".bak"); string(data) != string(old) {
+		t.Errorf("backup %q, want the 0.5 file", data)
+	}
+	if _, migrated, lerr := loadProject(jspath); migrated || lerr != nil {
+		t.Errorf("saved file: migrated %v, error %v", migrated, lerr)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	punctModelName   = "punctuation.model"
+	punctModelHeader = "trsubtitle-punct 1"
+	punctSmoothing   = 0.5
+)
+
+//每个词后的标点：无 逗号 句号 问号 感叹号
+var punctLabels = []string{"", ",", ".", "?", "!"}
+
+//离线标点模型：按词及前后词统计其后标点的次数(朴素贝叶斯)
+type punctModel struct {
+	prior  [5]int
+	counts map[string]*[5]int
+	//各类特征(w= n= 等)的取值数，用于平滑
+	vocab map[string]int
+}
+
+var (
+	punctWordReg = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’][\p{L}\p{N}]+)*`)
+	srtNumReg    = regexp.MustCompile(`^\d+$`)
+	srtTimeLine  = regexp.MustCompile(`^\d+:\d+:\d+[,.]\d+ --> `)
+)
+
+func newPunctModel() *punctModel {
+	return &punctModel{counts: make(map[string]*[5]int)}
+}
+
+//两个词之间的标点，多个标点时取句末标点
+func punctLabel(between string) int {
+	switch {
+	case strings.ContainsAny(between, "?？"):
+		return 3
+	case strings.ContainsAny(between, "!！"):
+		return 4
+	case strings.ContainsAny(between, ".。…"):
+		return 2
+	case strings.ContainsAny(between, ",，;；:：—"):
+		return 1
+	}
+	return 0
+}
+
+//首字母大写(I 除外)
+func capitalized(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r) && word != "I" && !strings.HasPrefix(word, "I'")
+}
+
+//第 i 个词的特征：本词、前后词、后一个词是否大写
+func punctFeatures(words []string, i int) []string {
+	word := strings.ToLower(words[i])
+	prev, next, nextcap := "<s>", "</s>", "0"
+	if i > 0 {
+		prev = strings.ToLower(words[i-1])
+	}
+	if i+1 < len(words) {
+		next = strings.ToLower(words[i+1])
+		if capitalized(words[i+1]) {
+			nextcap = "1"
+		}
+	}
+	return []string{"w=" + word, "n=" + next, "wn=" + word + " " + next, "pw=" + prev + " " + word, "nc=" + nextcap}
+}
+
+//以带标点的文本训练，文本中的换行视为普通空格
+func (m *punctModel) train(text string) {
+	locs := punctWordReg.FindAllStringIndex(text, -1)
+	words := make([]string, len(locs))
+	for i, loc := range locs {
+		words[i] = text[loc[0]:loc[1]]
+	}
+	for i, loc := range locs {
+		end := len(text)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		label := punctLabel(text[loc[1]:end])
+		m.prior[label]++
+		m.vocab = nil
+		for _, f := range punctFeatures(words, i) {
+			c, ok := m.counts[f]
+			if !ok {
+				c = new([5]int)
+				m.counts[f] = c
+			}
+			c[label]++
+		}
+	}
+}
+
+func featureType(f string) string {
+	return f[0 : strings.Index(f, "=")+1]
+}
+
+func (m *punctModel) countVocab() {
+	m.vocab = make(map[string]int)
+	for f := range m.counts {
+		m.vocab[featureType(f)]++
+	}
+}
+
+//预测第 i 个词后的标点，final 为 true 时为句子最后一个词，只取句末标点
+func (m *punctModel) predict(words []string, i int, final bool) int {
+	if m.vocab == nil {
+		m.countVocab()
+	}
+	total := 0
+	for _, n := range m.prior {
+		total += n
+	}
+	best, bestscore := 0, math.Inf(-1)
+	for label := range punctLabels {
+		if final && label < 2 {
+			continue
+		}
+		score := math.Log(float64(m.prior[label]+1) / float64(total+len(punctLabels)))
+		//按该类特征的取值数平滑，未出现过的特征不计算
+		for _, f := range punctFeatures(words, i) {
+			c, ok := m.counts[f]
+			if !ok {
+				continue
+			}
+			smooth := float64(m.prior[label]) + punctSmoothing*float64(m.vocab[featureType(f)])
+			score += math.Log((float64(c[label]) + punctSmoothing) / smooth)
+		}
+		if score > bestscore {
+			best, bestscore = label, score
+		}
+	}
+	return best
+}
+
+//为一句原文添加标点，已有标点的位置不变，不改变原文的词
+func (m *punctModel) Punctuate(text string) string {
+	locs := punctWordReg.FindAllStringIndex(text, -1)
+	if len(locs) == 0 {
+		return text
+	}
+	words := make([]string, len(locs))
+	for i, loc := range locs {
+		words[i] = text[loc[0]:loc[1]]
+	}
+	var b strings.Builder
+	last := 0
+	for i, loc := range locs {
+		end := len(text)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		b.WriteString(text[last:loc[1]])
+		last = loc[1]
+		between := text[loc[1]:end]
+		if len(strings.TrimFunc(between, unicode.IsSpace)) > 0 {
+			//已有标点或其它符号
+			continue
+		}
+		if label := m.predict(words, i, i == len(locs)-1); label > 0 {
+			b.WriteString(punctLabels[label])
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+//模型文件：第一行为版本，其后每行为 特征<TAB>各标点的次数
+func (m *punctModel) save(path string) error {
+	var b bytes.Buffer
+	b.WriteString(punctModelHeader + "\n")
+	b.WriteString("<prior>")
+	for _, n := range m.prior {
+		b.WriteString("\t" + strconv.Itoa(n))
+	}
+	b.WriteString("\n")
+	features := make([]string, 0, len(m.counts))
+	for f := range m.counts {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	for _, f := range features {
+		b.WriteString(f)
+		for _, n := range m.counts[f] {
+			b.WriteString("\t" + strconv.Itoa(n))
+		}
+		b.WriteString("\n")
+	}
+	tmpfile, terr := createTempFile(path)
+	if terr != nil {
+		return terr
+	}
+	_, werr := tmpfile.Write(b.Bytes())
+	tmpfile.Close()
+	if werr != nil {
+		os.Remove(tmpfile.Name())
+		return werr
+	}
+	return renameTempFile(tmpfile.Name(), path)
+}
+
+func loadPunctModel(path string) (*punctModel, error) {
+	data, rerr := ioutil.ReadFile(path)
+	if rerr != nil {
+		return nil, rerr
+	}
+	m := newPunctModel()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if lineno == 1 {
+			if line != punctModelHeader {
+				return nil, errors.New("not a TrSubtitle punctuation model (" + punctModelHeader + ")")
+			}
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(punctLabels)+1 {
+			return nil, errors.New("line " + strconv.Itoa(lineno) + ": " + strconv.Itoa(len(punctLabels)+1) + " fields expected")
+		}
+		var c [5]int
+		for k := range c {
+			n, nerr := strconv.Atoi(fields[k+1])
+			if nerr != nil {
+				return nil, errors.New("line " + strconv.Itoa(lineno) + ": " + nerr.Error())
+			}
+			c[k] = n
+		}
+		if fields[0] == "<prior>" {
+			m.prior = c
+		} else {
+			m.counts[fields[0]] = &c
+		}
+	}
+	return m, scanner.Err()
+}
+
+//查找模型文件：-pmodel 参数、当前目录下、程序目录下的 punctuation.model，未找到时返回空字符串
+func findPunctModel() string {
+	if len(pmodelpath) > 0 {
+		return pmodelpath
+	}
+	if _, merr := os.Stat(punctModelName); merr == nil {
+		return punctModelName
+	}
+	if exepath, eerr := os.Executable(); eerr == nil {
+		exemodel := filepath.Join(filepath.Dir(exepath), punctModelName)
+		if _, merr := os.Stat(exemodel); merr == nil {
+			return exemodel
+		}
+	}
+	return ""
+}
+
+var (
+	offlinePunct     *punctModel
+	offlinePunctOnce sync.Once
+)
+
+//载入离线标点模型，没有内置模型；未找到模型文件时提示用 -ptrain 训练，返回nil(不添加标点)
+func loadOfflinePunct() *punctModel {
+	offlinePunctOnce.Do(func() {
+		path := findPunctModel()
+		if len(path) == 0 {
+			printWarning("No punctuation.model found, the subtitle is left without punctuation. "+
+				"Train a model from punctuated subtitles of similar shows with -ptrain, give its file name with -pmodel, or use -punct remote.",
+				"未发现punctuation.model标点模型，字幕未添加标点. 请用 -ptrain 以同类剧集带标点的字幕训练模型，"+
+					"用 -pmodel 指定模型文件，或使用 -punct remote.")
+			return
+		}
+		m, lerr := loadPunctModel(path)
+		if lerr != nil {
+			if slang == "en" {
+				fmt.Fprintln(os.Stderr, "Invalid punctuation model: "+path)
+			} else {
+				fmt.Fprintln(os.Stderr, "标点模型格式错误: "+path)
+			}
+			fmt.Fprintln(os.Stderr, lerr.Error())
+			os.Exit(1)
+		}
+		offlinePunct = m
+	})
+	return offlinePunct
+}
+
+//训练语料中的字幕文本，srt文件去掉序号及时间轴
+func corpusText(data []byte) string {
+	var b strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if srtNumReg.MatchString(line) || srtTimeLine.MatchString(line) {
+			continue
+		}
+		b.WriteString(htmlTagReg.ReplaceAllString(assTagReg.ReplaceAllString(line, ""), "") + "\n")
+	}
+	return b.String()
+}
+
+//由带标点的字幕或文本文件训练标点模型，保存到 -pmodel 或 punctuation.model
+func TrainPunctModel() {
+	m := newPunctModel()
+	files := 0
+	for _, pattern := range strings.Split(ptrainpaths, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 {
+			printWarning("No corpus files found: "+pattern, "未发现语料文件: "+pattern)
+		}
+		for _, path := range matches {
+			data, _, rerr := readTextFile(path)
+			if rerr != nil {
+				printWarning(rerr.Error(), rerr.Error())
+				continue
+			}
+			m.train(corpusText(data))
+			files++
+		}
+	}
+	words := 0
+	for _, n := range m.prior {
+		words += n
+	}
+	if words == 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "No text found in the corpus files.")
+		} else {
+			fmt.Fprintln(os.Stderr, "语料文件中没有文本.")
+		}
+		os.Exit(1)
+	}
+
+	if words < minCorpusWords {
+		printWarning("The corpus has only "+strconv.Itoa(words)+" words, the punctuation will be unreliable. "+
+			"Use at least "+strconv.Itoa(minCorpusWords)+" words of punctuated subtitles.",
+			"语料只有 "+strconv.Itoa(words)+" 个词，标点结果不可靠. 请使用至少 "+strconv.Itoa(minCorpusWords)+" 个词的带标点字幕.")
+	}
+
+	modelpath := pmodelpath
+	if len(modelpath) == 0 {
+		modelpath = punctModelName
+	}
+	checkOutput(checkOverwrite(modelpath))
+	checkError(m.save(modelpath))
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Trained the punctuation model with "+strconv.Itoa(words)+" words from "+
+			strconv.Itoa(files)+" files: "+modelpath)
+	} else {
+		fmt.Fprintln(os.Stderr, "已由 "+strconv.Itoa(files)+" 个文件的 "+strconv.Itoa(words)+" 个词训练标点模型: "+modelpath)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//测试用的带标点语料，实际使用时需要至少 minCorpusWords 个词
+const testPunctCorpus = `Where are you going? I am going home. Are you hungry? Yes, I am hungry.
+Where is he? He is at home. Are you sure? No, I am not sure.
+Where are they? They are at school. Are you ready? Yes, we are ready.
+Wow! That is great! I know, right? Okay, let's go.`
+
+func TestPunctLabel(t *testing.T) {
+	tests := []struct {
+		between string
+		want    int
+	}{
+		{" ", 0},
+		{", ", 1},
+		{"; ", 1},
+		{". ", 2},
+		{"... ", 2},
+		{"?! ", 3},
+		{"! ", 4},
+		{"。", 2},
+	}
+	for _, tt := range tests {
+		if got := punctLabel(tt.between); got != tt.want {
+			t.Errorf("punctLabel(%q) = %d, want %d", tt.between, got, tt.want)
+		}
+	}
+}
+
+func TestPunctModel(t *testing.T) {
+	m := newPunctModel()
+	m.train(testPunctCorpus)
+	path := filepath.Join(t.TempDir(), punctModelName)
+	if serr := m.save(path); serr != nil {
+		t.Fatal(serr)
+	}
+	loaded, lerr := loadPunctModel(path)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	if !reflect.DeepEqual(loaded.prior, m.prior) || len(loaded.counts) != len(m.counts) {
+		t.Errorf("loaded model differs: prior %v, want %v", loaded.prior, m.prior)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Where are you going", "Where are you going?"},
+		{"Yes I am hungry", "Yes, I am hungry."},
+		{"I am going home", "I am going home."},
+		//已有的标点不变
+		{"Wait, where are you going", "Wait, where are you going?"},
+	}
+	for _, tt := range tests {
+		for _, model := range []*punctModel{m, loaded} {
+			if got := model.Punctuate(tt.text); got != tt.want {
+				t.Errorf("Punctuate(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		}
+	}
+}
+
+//没有标点模型时保留原文
+func TestOfflinePunctuatorWithoutModel(t *testing.T) {
+	if got, perr := (offlinePunctuator{}).Punctuate("hello there"); got != "hello there" || perr != nil {
+		t.Errorf("Punctuate without a model = %q %v", got, perr)
+	}
+}
+
+func TestLoadPunctModelErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"model\n", "not a TrSubtitle punctuation model"},
+		{punctModelHeader + "\nw=a\t1\t2\n", "6 fields expected"},
+		{punctModelHeader + "\nw=a\t1\t2\tx\t4\t5\n", "line 2"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), punctModelName)
+		tmpfile, terr := createTempFile(path)
+		if terr != nil {
+			t.Fatal(terr)
+		}
+		tmpfile.WriteString(tt.data)
+		tmpfile.Close()
+		renameTempFile(tmpfile.Name(), path)
+		if _, lerr := loadPunctModel(path); lerr == nil || !strings.Contains(lerr.Error(), tt.want) {
+			t.Errorf("loadPunctModel(%q): error %v, want %q", tt.data, lerr, tt.want)
+		}
+	}
+}
+
+func TestCorpusText(t *testing.T) {
+	srt := "1\r\n00:00:01,000 --> 00:00:02,000\r\n<i>Hello</i> there.\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\n{\\an8}Bye.\r\n"
+	if got, want := corpusText([]byte(srt)), "Hello there.\n\nBye.\n\n"; got != want {
+		t.Errorf("corpusText = %q, want %q", got, want)
+	}
+}
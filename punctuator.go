@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultPunctURL = "http://bark.phon.ioc.ee/punctuator"
+
+//为一句原文添加标点，出错时返回 error，由调用方保留原文
+type Punctuator interface {
+	Punctuate(text string) (string, error)
+}
+
+//离线标点模型，没有模型时保留原文
+type offlinePunctuator struct {
+	model *punctModel
+}
+
+func (p offlinePunctuator) Punctuate(text string) (string, error) {
+	if p.model == nil {
+		return text, nil
+	}
+	return p.model.Punctuate(text), nil
+}
+
+//HTTP标点服务：method 为 POST(表单) 或 GET(查询参数)，原文放在 field 字段中，
+//response 为 text 时响应即为结果，为 json:字段 时取JSON中的字段(可用 . 分隔多级)
+type httpPunctuator struct {
+	url      string
+	method   string
+	field    string
+	response string
+	client   *http.Client
+}
+
+func newHTTPPunctuator() *httpPunctuator {
+	p := &httpPunctuator{
+		url:      punctURL,
+		method:   strings.ToUpper(punctMethod),
+		field:    punctField,
+		response: punctResponse,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	u, uerr := url.Parse(p.url)
+	switch {
+	case uerr != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0:
+		punctOptionError("-purl", p.url, "http(s)://host/path")
+	case p.method != http.MethodPost && p.method != http.MethodGet:
+		punctOptionError("-pmethod", punctMethod, "POST GET")
+	case len(p.field) == 0:
+		punctOptionError("-pfield", p.field, "text")
+	case p.response != "text" && (!strings.HasPrefix(p.response, "json:") || len(p.response) == len("json:")):
+		punctOptionError("-presp", p.response, "text json:field")
+	}
+	return p
+}
+
+func punctOptionError(name, value, expected string) {
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Invalid "+name+": \""+value+"\" ("+expected+")")
+	} else {
+		fmt.Fprintln(os.Stderr, name+" 参数错误: \""+value+"\" ("+expected+")")
+	}
+	os.Exit(1)
+}
+
+func (p *httpPunctuator) Punctuate(text string) (string, error) {
+	values := url.Values{p.field: {text}}
+	var resp *http.Response
+	var rerr error
+	if p.method == http.MethodGet {
+		sep := "?"
+		if strings.Contains(p.url, "?") {
+			sep = "&"
+		}
+		resp, rerr = p.client.Get(p.url + sep + values.Encode())
+	} else {
+		resp, rerr = p.client.PostForm(p.url, values)
+	}
+	if rerr != nil {
+		return "", rerr
+	}
+	defer resp.Body.Close()
+	body, berr := ioutil.ReadAll(resp.Body)
+	if berr != nil {
+		return "", berr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	result := string(body)
+	if p.response != "text" {
+		var jerr error
+		if result, jerr = jsonField(body, strings.TrimPrefix(p.response, "json:")); jerr != nil {
+			return "", jerr
+		}
+	}
+	result = strings.TrimSpace(result)
+	if unmatched, words := unmatchedPunctWords(text, result); float64(unmatched) > maxUnmatchedRatio*float64(words) {
+		return "", errors.New("the response does not match the text: " + strconv.Itoa(unmatched) + " of " + strconv.Itoa(words) + " words differ")
+	}
+	return result, nil
+}
+
+//取JSON中的字符串字段，path 以 . 分隔多级
+func jsonField(data []byte, path string) (string, error) {
+	var v interface{}
+	if jerr := json.Unmarshal(data, &v); jerr != nil {
+		return "", jerr
+	}
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", errors.New("no field \"" + path + "\" in the response")
+		}
+		if v, ok = m[key]; !ok {
+			return "", errors.New("no field \"" + path + "\" in the response")
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("field \"" + path + "\" is not a string")
+	}
+	return s, nil
+}
+
+//标点服务可能改变部分词(大小写、缩写拆分、数字格式)，
+//对齐后未能对应的词超过原文词数的该比例时，视为错误的响应(如错误页面)
+const maxUnmatchedRatio = 0.25
+
+//数字中的小数点及千位分隔符不拆分，如 3.5 1,000
+var alignWordReg = regexp.MustCompile(`\p{N}+(?:[.,]\p{N}+)+|[\p{L}\p{N}]+(?:['’][\p{L}\p{N}]+)*`)
+
+//按编辑距离对齐添加标点前后的词，返回未能对应的词数(增加、删除或完全不同的词)及原文词数
+func unmatchedPunctWords(text, result string) (int, int) {
+	words := alignWordReg.FindAllString(text, -1)
+	rwords := alignWordReg.FindAllString(result, -1)
+	a, b := normalizeTokens(words), normalizeTokens(rwords)
+	unmatched := 0
+	for _, pair := range alignTokens(words, rwords) {
+		if pair[0] < 0 || pair[1] < 0 || alignCost(a[pair[0]], b[pair[1]]) == alignDiffer {
+			unmatched++
+		}
+	}
+	return unmatched, len(words)
+}
+
+//按 -punct 选择标点方式
+func newPunctuator() Punctuator {
+	switch punctbackend {
+	case "offline":
+		return offlinePunctuator{loadOfflinePunct()}
+	case "remote":
+		p := newHTTPPunctuator()
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Punctuation is being accessed at "+p.url+"."+"\n")
+		} else {
+			fmt.Fprintln(os.Stderr, "正在访问"+p.url+"获取标点符号。"+"\n")
+		}
+		return p
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Unknown punctuation backend: "+punctbackend+" (offline remote)")
+	} else {
+		fmt.Fprintln(os.Stderr, "未知的标点方式: "+punctbackend+" (offline remote)")
+	}
+	os.Exit(1)
+	return nil
+}
+
+//添加标点失败的句子保留原文，逐句提示原因，结束后提示失败的句子
+func punctFailure(pos int, perr error) {
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "sentence "+strconv.Itoa(pos)+": punctuation failed: "+perr.Error())
+	} else {
+		fmt.Fprintln(os.Stderr, "句子 "+strconv.Itoa(pos)+": 添加标点失败: "+perr.Error())
+	}
+}
+
+func reportPunctFailures(failed []string) {
+	if len(failed) == 0 {
+		return
+	}
+	printWarning(strconv.Itoa(len(failed))+" sentences were left without punctuation: "+joinPos(failed),
+		strconv.Itoa(len(failed))+" 句未能添加标点，保留原文: "+joinPos(failed))
+}
+
+//按编辑距离对齐添加标点后的句子与原文各行的词，将标点转移到原文各行中
+//标点服务改变了某些词(大小写、缩写拆分、数字格式)时，其余词的标点仍能对应
+const (
+	alignGap     = 2
+	alignSimilar = 1
+	alignDiffer  = 3
+	alignBand    = 50
+)
+
+func isWordToken(token string) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+//转移的标点：逗号 句号 问号 感叹号 冒号 分号，不包括连字符
+func isPunctToken(token string) bool {
+	return token != "-" && containEndSym(token)
+}
+
+var alignReplacer = strings.NewReplacer(",", "", ".", "", "'", "", "’", "")
+
+func normalizeTokens(tokens []string) []string {
+	normalized := make([]string, len(tokens))
+	for i, token := range tokens {
+		normalized[i] = alignReplacer.Replace(strings.ToLower(token))
+	}
+	return normalized
+}
+
+func alignCost(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case len(a) >= 2 && len(b) >= 2 && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)):
+		return alignSimilar
+	}
+	return alignDiffer
+}
+
+//Needleman–Wunsch 全局对齐，只计算对角线附近的带状区域；返回各对齐位置 (i, j)，-1 为空位
+func alignTokens(a, b []string) [][2]int {
+	a, b = normalizeTokens(a), normalizeTokens(b)
+	n, m := len(a), len(b)
+	w := alignBand + n - m
+	if m > n {
+		w = alignBand + m - n
+	}
+	lo := func(i int) int {
+		if n == 0 {
+			return -w
+		}
+		return i*m/n - w
+	}
+	const inf = int(^uint(0) >> 2)
+	rows := make([][]int, n+1)
+	get := func(i, j int) int {
+		if i < 0 || j < 0 || j-lo(i) < 0 || j-lo(i) >= len(rows[i]) {
+			return inf
+		}
+		return rows[i][j-lo(i)]
+	}
+	for i := 0; i <= n; i++ {
+		rows[i] = make([]int, 2*w+1)
+		for k := range rows[i] {
+			j := lo(i) + k
+			switch {
+			case j < 0 || j > m:
+				rows[i][k] = inf
+			case i == 0:
+				rows[i][k] = j * alignGap
+			case j == 0:
+				rows[i][k] = i * alignGap
+			default:
+				best := get(i-1, j-1) + alignCost(a[i-1], b[j-1])
+				if d := get(i-1, j) + alignGap; d < best {
+					best = d
+				}
+				if d := get(i, j-1) + alignGap; d < best {
+					best = d
+				}
+				rows[i][k] = best
+			}
+		}
+	}
+
+	var pairs [][2]int
+	i, j := n, m
+	for i > 0 || j > 0 {
+		cur := get(i, j)
+		switch {
+		case i > 0 && j > 0 && cur == get(i-1, j-1)+alignCost(a[i-1], b[j-1]):
+			i, j = i-1, j-1
+			pairs = append(pairs, [2]int{i, j})
+		case i > 0 && cur == get(i-1, j)+alignGap:
+			i--
+			pairs = append(pairs, [2]int{i, -1})
+		default:
+			j--
+			pairs = append(pairs, [2]int{-1, j})
+		}
+	}
+	for l, r := 0, len(pairs)-1; l < r; l, r = l+1, r-1 {
+		pairs[l], pairs[r] = pairs[r], pairs[l]
+	}
+	return pairs
+}
+
+//将 body 中的标点按对齐结果加到各行原文的词后，原文中已有标点的位置不变
+func transferPunct(seg Segmenter, body string, lines []string) []string {
+	var words, marks []string
+	for _, token := range seg.Segment(body) {
+		switch {
+		case isWordToken(token):
+			words = append(words, token)
+			marks = append(marks, "")
+		case isPunctToken(token) && len(words) > 0:
+			marks[len(marks)-1] += token
+		}
+	}
+
+	//原文各行的分词，及各词所在的行和位置
+	type wordPos struct{ line, token int }
+	linetokens := make([][]string, len(lines))
+	var subwords []string
+	var positions []wordPos
+	for l, line := range lines {
+		linetokens[l] = seg.Segment(line)
+		for k, token := range linetokens[l] {
+			if isWordToken(token) {
+				subwords = append(subwords, token)
+				positions = append(positions, wordPos{l, k})
+			}
+		}
+	}
+
+	//空位的标点加到前一个原文词后，句末标点优先于逗号等
+	added := make([]string, len(subwords))
+	last := -1
+	for _, pair := range alignTokens(words, subwords) {
+		if pair[1] >= 0 {
+			last = pair[1]
+		}
+		if pair[0] < 0 || last < 0 || len(marks[pair[0]]) == 0 {
+			continue
+		}
+		if len(added[last]) == 0 || punctLabel(marks[pair[0]]) >= 2 {
+			added[last] = marks[pair[0]]
+		}
+	}
+
+	for w := range positions {
+		if len(added[w]) == 0 {
+			continue
+		}
+		pos := positions[w]
+		tokens := linetokens[pos.line]
+		//原文该词后到下一个词之间已有标点或撇号(缩写)时不添加
+		punctuated := false
+		for k := pos.token + 1; k < len(tokens) && !isWordToken(tokens[k]); k++ {
+			if isPunctToken(tokens[k]) || tokens[k] == "'" {
+				punctuated = true
+				break
+			}
+		}
+		if !punctuated {
+			tokens[pos.token] += added[w]
+		}
+	}
+	result := make([]string, len(lines))
+	for l := range lines {
+		result[l] = strings.Join(strings.Fields(strings.Join(linetokens[l], "")), " ")
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmatchedPunctWords(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		result    string
+		unmatched int
+	}{
+		{"same", "where are you going", "Where are you going?", 0},
+		{"respelled", "i dont know its 1000 dollars", "I don't know, it's 1,000 dollars.", 0},
+		{"split", "we cant stay here", "We can not stay here.", 1},
+		{"added", "where are you going", "So, where are you going now?", 2},
+		{"dropped", "well where are you going", "Where are you going?", 1},
+		{"replaced", "where are you going", "Where were they going?", 2},
+		{"error page", "where are you going", "502 Bad Gateway", 4},
+		{"empty", "", "", 0},
+	}
+	for _, tt := range tests {
+		if got, _ := unmatchedPunctWords(tt.text, tt.result); got != tt.unmatched {
+			t.Errorf("%s: %d unmatched words, want %d", tt.name, got, tt.unmatched)
+		}
+	}
+}
+
+//未能对应的词不超过原文的 1/4 时接受标点服务的结果
+func TestHTTPPunctuator(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		name     string
+		response string
+		wanterr  string
+	}{
+		{"respelled", "I don't know, it's 1,000 dollars.", ""},
+		{"one added", "So, I dont know its 1000 dollars.", ""},
+		{"one dropped", "I dont know 1000 dollars.", ""},
+		{"too many changes", "We don't know, it was 1,000 euros.", "3 of 6 words differ"},
+		{"error page", "<html>Service Unavailable</html>", "words differ"},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.response))
+		}))
+		p := &httpPunctuator{url: server.URL, method: http.MethodPost, field: "text", response: "text", client: server.Client()}
+		got, perr := p.Punctuate("i dont know its 1000 dollars")
+		server.Close()
+		switch {
+		case len(tt.wanterr) == 0 && (perr != nil || got != tt.response):
+			t.Errorf("%s: %q %v, want %q", tt.name, got, perr, tt.response)
+		case len(tt.wanterr) > 0 && (perr == nil || !strings.Contains(perr.Error(), tt.wanterr)):
+			t.Errorf("%s: error %v, want %q", tt.name, perr, tt.wanterr)
+		}
+	}
+}
+
+//-pmethod GET 时原文放在查询参数中，-presp json: 时取JSON中的字段
+func TestHTTPPunctuatorRequest(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		method   string
+		url      string
+		response string
+		body     string
+		want     string
+		wanterr  string
+	}{
+		{http.MethodPost, "/punct", "text", "Hello there.", "Hello there.", ""},
+		{http.MethodGet, "/punct?lang=en", "text", "Hello there.", "Hello there.", ""},
+		{http.MethodPost, "/punct", "json:result.text", `{"result": {"text": "Hello there."}}`, "Hello there.", ""},
+		{http.MethodPost, "/punct", "json:result.text", `{"result": "Hello there."}`, "", "no field"},
+		{http.MethodPost, "/punct", "json:result", `{"result": 1}`, "", "is not a string"},
+		{http.MethodPost, "/punct", "json:result", `Hello there.`, "", "invalid character"},
+		{http.MethodPost, "/missing", "text", "Hello there.", "", "404"},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/punct" || r.Method != tt.method || r.FormValue("txt") != "hello there" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(tt.body))
+		}))
+		p := &httpPunctuator{url: server.URL + tt.url, method: tt.method, field: "txt", response: tt.response, client: server.Client()}
+		got, perr := p.Punctuate("hello there")
+		server.Close()
+		switch {
+		case len(tt.wanterr) == 0 && (perr != nil || got != tt.want):
+			t.Errorf("%s %s %s: %q %v, want %q", tt.method, tt.url, tt.response, got, perr, tt.want)
+		case len(tt.wanterr) > 0 && (perr == nil || !strings.Contains(perr.Error(), tt.wanterr)):
+			t.Errorf("%s %s %s: error %v, want %q", tt.method, tt.url, tt.response, perr, tt.wanterr)
+		}
+	}
+}
+
+//标点服务改变了某些词时，其余词的标点仍加到原文各行的对应位置
+func TestTransferPunct(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		lines []string
+		want  []string
+	}{
+		{"same", "Where are you going? Home.", []string{"where are you", "going home"}, []string{"where are you", "going? home."}},
+		{"respelled", "I don't know, it's 1,000 dollars.", []string{"i dont know its", "1000 dollars"}, []string{"i dont know, its", "1000 dollars."}},
+		{"added", "Well, so, where are you going?", []string{"well where", "are you going"}, []string{"well, where", "are you going?"}},
+		{"dropped", "Where are you going?", []string{"uh where are", "you going"}, []string{"uh where are", "you going?"}},
+		{"punctuated", "Wait, what? No.", []string{"wait, what", "no"}, []string{"wait, what?", "no."}},
+	}
+	for _, tt := range tests {
+		if got := transferPunct(enSegmenter{}, tt.body, append([]string(nil), tt.lines...)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+//歌词等非对白字幕不发送给标点服务，保留原文
+func TestOSubAddPunctuator(t *testing.T) {
+	keepFlags(t)
+	defer func(backend, purl, method, field, resp, pfile string) {
+		punctbackend, punctURL, punctMethod, punctField, punctResponse, pgfilepath = backend, purl, method, field, resp, pfile
+	}(punctbackend, punctURL, punctMethod, punctField, punctResponse, pgfilepath)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.FormValue("text"))
+		w.Write([]byte(strings.TrimSpace(r.FormValue("text")) + "."))
+	}))
+	defer server.Close()
+	punctbackend, punctURL, punctMethod, punctField, punctResponse = "remote", server.URL, "POST", "text", "text"
+	pgfilepath = filepath.Join(t.TempDir(), "Movie.srt")
+	subs := []subInfo{
+		{DPos: 1, DESub: "hello there \n", SplitInfo: []subpart{{SPos: 1, STime: "00:00:01,000 --> 00:00:02,000", SSub: "hello there"}}},
+		{DPos: 2, DESub: "la la la \n", Type: "lyric", SplitInfo: []subpart{{SPos: 2, STime: "00:00:03,000 --> 00:00:04,000", SSub: "la la la"}}},
+	}
+
+	oSubAddPunctuator(subs)
+
+	data, rerr := ioutil.ReadFile(pgfilepath + ".en.srt")
+	if rerr != nil || !strings.Contains(string(data), "hello there.") || strings.Contains(string(data), "la la la.") {
+		t.Errorf("punctuated subtitle %q, error %v", data, rerr)
+	}
+	if len(requests) != 1 {
+		t.Errorf("requests %q, want only the dialogue", requests)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+//根据json文件内修改过的整句译文，重新切分各行字幕
+func JsonResplitSub() {
+
+	checkJsonFile()
+
+	project := readProject(josnfilepath)
+	allsub := project.subs()
+
+	// 按原文及译文语言确定分词方式
+	srcseg := langSegmenter(srclang)
+	tgseg := langSegmenter(tglang)
+
+	resplitNum := 0
+	for i := range allsub {
+		//旧版json文件没有译文摘要，记录当前译文的摘要，视为未修改
+		if len(allsub[i].DCHash) == 0 {
+			allsub[i].DCHash = subHash(allsub[i].DCSub)
+			continue
+		}
+		if allsub[i].DCHash == subHash(allsub[i].DCSub) {
+			continue
+		}
+		splitSubLine(srcseg, tgseg, &allsub[i])
+		resplitNum++
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Re-split sentence: "+strconv.Itoa(allsub[i].DPos))
+		} else {
+			fmt.Fprintln(os.Stderr, "重新切分句子: "+strconv.Itoa(allsub[i].DPos))
+		}
+	}
+
+	//先更新辅助json文件，字幕文件不能生成(如已存在)时不丢失重新切分的结果
+	//json由标准输入读取时按 -jsout 参数输出
+	project.setSubs(allsub)
+	if josnfilepath != "-" {
+		saveProject(josnfilepath, project)
+	} else if len(jsoutpath) > 0 {
+		saveProject(jsoutpath, project)
+	}
+
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Re-split "+strconv.Itoa(resplitNum)+" modified sentences."+"\n")
+	} else {
+		fmt.Fprintln(os.Stderr, "共重新切分 "+strconv.Itoa(resplitNum)+" 句被修改的译文."+"\n")
+	}
+
+	//json由标准输入读取时已无法再次读取，直接由修改后的项目生成字幕
+	checkOutput(renderProject(project))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJsonResplitSub(t *testing.T) {
+	keepFlags(t)
+	tglang = "ja"
+	subs := testSubs()
+	//第一句为旧版json文件(没有译文摘要)，记录摘要后不重新切分；第二句的整句译文被修改
+	subs[0].DCHash = ""
+	subs[0].SplitInfo[0].SCSub = "古い"
+	subs[1].DCSub = "どこへ行くの？"
+	josnfilepath = writeTestProject(t, subs)
+
+	JsonResplitSub()
+
+	resplit := readProject(josnfilepath).subs()
+	tests := []struct {
+		sentence int
+		want     string
+		hash     string
+	}{
+		{0, "古い", subHash("你好。")},
+		{1, "どこへ行くの？", subHash("どこへ行くの？")},
+	}
+	for _, tt := range tests {
+		sub := resplit[tt.sentence]
+		var lines []string
+		for _, part := range sub.SplitInfo {
+			lines = append(lines, part.SCSub)
+		}
+		if got := joinLines(tglang, lines); got != tt.want {
+			t.Errorf("sentence %d: lines %q, want %q", sub.DPos, lines, tt.want)
+		}
+		if sub.DCHash != tt.hash {
+			t.Errorf("sentence %d: hash %s, want %s", sub.DPos, sub.DCHash, tt.hash)
+		}
+	}
+	data, rerr := ioutil.ReadFile(jsonChsFileName(josnfilepath))
+	if rerr != nil || !strings.HasPrefix(string(data), jsfirstext) {
+		t.Errorf("subtitle was not generated: %v", rerr)
+	}
+}
+
+//json由标准输入读取时，由修改后的项目生成字幕，不再读取标准输入
+func TestJsonResplitSubStdin(t *testing.T) {
+	keepFlags(t)
+	tglang = "ja"
+	subs := testSubs()
+	subs[1].DCSub = "どこへ行くの？"
+	jspath := writeTestProject(t, subs)
+	stdin, oerr := os.Open(jspath)
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+	dir := t.TempDir()
+	josnfilepath = "-"
+	jsoutpath = filepath.Join(dir, "out.json")
+	outpath = filepath.Join(dir, "out.srt")
+
+	JsonResplitSub()
+	stdin.Close()
+
+	data, rerr := ioutil.ReadFile(outpath)
+	if rerr != nil || !strings.Contains(string(data), "どこへ") {
+		t.Errorf("subtitle was not generated from standard input: %v %q", rerr, data)
+	}
+	if text := readProject(jsoutpath).Cues[1].Translation; text != "どこへ行くの？" {
+		t.Errorf("-jsout translation %q", text)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//审校时的检查标准：每秒字数及每行字数，中文、日文、韩文按字计算
+func reviewLimits(lang string) (float64, int) {
+	if isCjkLang(lang) {
+		return 11, 16
+	}
+	return 20, 42
+}
+
+//一行字幕的检查结果
+func lineWarnings(part subpart) []string {
+	var warnings []string
+	maxcps, maxlen := reviewLimits(tglang)
+	if len(strings.TrimSpace(part.SCSub)) == 0 {
+		if len(strings.TrimSpace(part.SSub)) > 0 {
+			warnings = append(warnings, reviewText("no translation", "无译文"))
+		}
+		return warnings
+	}
+	if strings.Contains(part.SCSub, conflictStart) || strings.Contains(part.STime, conflictStart) {
+		warnings = append(warnings, reviewText("conflict marker", "冲突标记"))
+	}
+	if _, cps := lineCps(part); cps > maxcps {
+		warnings = append(warnings, strconv.FormatFloat(cps, 'f', 1, 64)+" cps > "+strconv.FormatFloat(maxcps, 'f', 0, 64))
+	}
+	if n := textLength(part.SCSub); n > maxlen {
+		warnings = append(warnings, reviewText(strconv.Itoa(n)+" chars > ", strconv.Itoa(n)+" 字 > ")+strconv.Itoa(maxlen))
+	}
+	return warnings
+}
+
+func cueWarnings(sub subInfo) int {
+	n := 0
+	for _, part := range sub.SplitInfo {
+		n += len(lineWarnings(part))
+	}
+	return n
+}
+
+//流程状态及负责人
+func flowText(flow workflow) string {
+	text := ""
+	if len(flow.Status) > 0 {
+		text += " " + flow.Status
+	}
+	if len(flow.Assignee) > 0 {
+		text += " @" + flow.Assignee
+	}
+	return text
+}
+
+func reviewText(en, zh string) string {
+	if slang == "en" {
+		return en
+	}
+	return zh
+}
+
+//交互式审校：逐句显示原文、译文及各行字幕，修改后保存到json文件并重新生成字幕
+type reviewer struct {
+	project  *subProject
+	subs     []subInfo
+	cur      int
+	modified bool
+	message  string
+	srcseg   Segmenter
+	tgseg    Segmenter
+	in       *bufio.Reader
+	out      io.Writer
+	tty      bool
+}
+
+func ReviewProject() {
+	checkJsonFile()
+	if josnfilepath == "-" {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "-review needs a json file, the standard input is used for the commands.")
+		} else {
+			fmt.Fprintln(os.Stderr, "-review 需要json文件，标准输入用于输入命令.")
+		}
+		os.Exit(1)
+	}
+	r := &reviewer{
+		project: readProject(josnfilepath),
+		srcseg:  langSegmenter(srclang),
+		tgseg:   langSegmenter(tglang),
+		in:      bufio.NewReader(os.Stdin),
+		out:     os.Stdout,
+	}
+	if fi, serr := os.Stdout.Stat(); serr == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		r.tty = true
+	}
+	r.subs = r.project.subs()
+	checkProjectSource(r.project)
+	r.run()
+}
+
+func (r *reviewer) color(code, text string) string {
+	if !r.tty {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+func (r *reviewer) show() {
+	if r.tty {
+		fmt.Fprint(r.out, "\033[H\033[2J")
+	}
+	sub := r.subs[r.cur]
+	total := 0
+	for _, s := range r.subs {
+		total += cueWarnings(s)
+	}
+	modified := ""
+	if r.modified {
+		modified = " *"
+	}
+	fmt.Fprintln(r.out, r.color("1", reviewText("Sentence ", "句子 ")+strconv.Itoa(r.cur+1)+"/"+strconv.Itoa(len(r.subs))+
+		"  pos "+strconv.Itoa(sub.DPos)+"  ["+cueState(sub)+flowText(sub.Flow)+"]")+"  "+
+		reviewText("warnings: ", "警告: ")+strconv.Itoa(total)+"  "+josnfilepath+modified)
+	fmt.Fprintln(r.out, "  "+srclang+": "+strings.TrimSpace(sub.DESub))
+	fmt.Fprintln(r.out, "  "+tglang+": "+sub.DCSub)
+	for _, c := range commentLines("  #", sub.Flow) {
+		fmt.Fprintln(r.out, r.color("33", c))
+	}
+	fmt.Fprintln(r.out)
+
+	for k, part := range sub.SplitInfo {
+		cps := ""
+		if _, lcps := lineCps(part); lcps > 0 {
+			cps = strconv.FormatFloat(lcps, 'f', 1, 64) + " cps"
+		}
+		fmt.Fprintln(r.out, " "+strconv.Itoa(k+1)+"  "+part.STime+"  "+cps+flowText(part.Flow))
+		fmt.Fprintln(r.out, "    "+part.SSub)
+		fmt.Fprintln(r.out, "    "+r.color("32", part.SCSub))
+		if warnings := lineWarnings(part); len(warnings) > 0 {
+			fmt.Fprintln(r.out, "    "+r.color("31", "! "+strings.Join(warnings, ", ")))
+		}
+		for _, c := range commentLines("    #", part.Flow) {
+			fmt.Fprintln(r.out, r.color("33", c))
+		}
+	}
+	fmt.Fprintln(r.out)
+	if len(r.message) > 0 {
+		fmt.Fprintln(r.out, r.color("33", r.message))
+		r.message = ""
+	}
+	fmt.Fprintln(r.out, reviewText(
+		"n/p next/previous  g N go to  w next warning  e edit sentence  e N edit line N\n"+
+			"< N / > N move the split after line N one word left/right  s save  q quit  ? help",
+		"n/p 下一句/上一句  g N 转到第N句  w 下一个警告  e 修改整句译文  e N 修改第N行译文\n"+
+			"< N / > N 第N行后的切分点左移/右移一个词  s 保存  q 退出  ? 帮助"))
+}
+
+//读取一行输入，输入结束时返回 false
+func (r *reviewer) readLine(prompt string) (string, bool) {
+	fmt.Fprint(r.out, prompt)
+	line, rerr := r.in.ReadString('\n')
+	if rerr != nil && len(line) == 0 {
+		fmt.Fprintln(r.out)
+		return "", false
+	}
+	return strings.TrimRight(line, "\r\n"), true
+}
+
+func (r *reviewer) run() {
+	if len(r.subs) == 0 {
+		fmt.Fprintln(os.Stderr, reviewText("The json file has no sentences.", "json文件中没有句子."))
+		return
+	}
+	for {
+		r.show()
+		line, ok := r.readLine("> ")
+		if !ok {
+			if r.modified {
+				printWarning("The changes were not saved.", "修改未保存.")
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			fields = []string{"n"}
+		}
+		arg := -1
+		if len(fields) > 1 {
+			if n, aerr := strconv.Atoi(fields[1]); aerr == nil {
+				arg = n
+			}
+		}
+		switch fields[0] {
+		case "n":
+			if r.cur+1 < len(r.subs) {
+				r.cur++
+			}
+		case "p":
+			if r.cur > 0 {
+				r.cur--
+			}
+		case "g":
+			if arg >= 1 && arg <= len(r.subs) {
+				r.cur = arg - 1
+			} else {
+				r.message = reviewText("No such sentence.", "没有此句子.")
+			}
+		case "?", "h":
+			//命令说明每次都会显示
+		case "w":
+			r.nextWarning()
+		case "e":
+			r.edit(arg, len(fields) > 1)
+		case "<", ">":
+			r.moveSplit(arg, fields[0] == "<")
+		case "s":
+			r.save()
+		case "q":
+			if r.modified {
+				answer, _ := r.readLine(reviewText("Save the changes? (y/n) ", "保存修改? (y/n) "))
+				if strings.HasPrefix(strings.ToLower(answer), "y") {
+					r.save()
+				}
+			}
+			return
+		default:
+			r.message = reviewText("Unknown command: ", "未知命令: ") + fields[0]
+		}
+	}
+}
+
+//转到下一个有警告的句子，到结尾后从头查找
+func (r *reviewer) nextWarning() {
+	for i := 1; i <= len(r.subs); i++ {
+		k := (r.cur + i) % len(r.subs)
+		if cueWarnings(r.subs[k]) > 0 {
+			r.cur = k
+			return
+		}
+	}
+	r.message = reviewText("No warnings.", "没有警告.")
+}
+
+//修改整句译文时重新切分；修改一行译文时直接替换该行，整句译文由各行合并
+func (r *reviewer) edit(line int, hasline bool) {
+	sub := &r.subs[r.cur]
+	if hasline && (line < 1 || line > len(sub.SplitInfo)) {
+		r.message = reviewText("No such line.", "没有此行.")
+		return
+	}
+	current := sub.DCSub
+	if hasline {
+		current = sub.SplitInfo[line-1].SCSub
+	}
+	fmt.Fprintln(r.out, reviewText("Current: ", "当前: ")+current)
+	text, ok := r.readLine(reviewText("New (empty to keep): ", "新译文(为空时不修改): "))
+	text = strings.TrimSpace(text)
+	if !ok || len(text) == 0 || text == current {
+		return
+	}
+	if hasline {
+		sub.SplitInfo[line-1].SCSub = text
+		joinSubLines(sub)
+	} else {
+		sub.DCSub = text
+		splitSubLine(r.srcseg, r.tgseg, sub)
+	}
+	touchSub(sub, "post-edited", true)
+	r.modified = true
+}
+
+//各行译文合并为整句译文，并更新摘要，-resplit 时不再重新切分
+func joinSubLines(sub *subInfo) {
+	var texts []string
+	for _, part := range sub.SplitInfo {
+		texts = append(texts, part.SCSub)
+	}
+	sub.DCSub = joinLines(tglang, texts)
+	sub.DCHash = subHash(sub.DCSub)
+}
+
+//第N行与第N+1行之间的切分点左移或右移一个词，行号无效或该行为空时返回 false
+func moveSubSplit(tgseg Segmenter, sub *subInfo, line int, left bool) bool {
+	if line < 1 || line >= len(sub.SplitInfo) {
+		return false
+	}
+	from, to := &sub.SplitInfo[line-1].SCSub, &sub.SplitInfo[line].SCSub
+	if !left {
+		from, to = to, from
+	}
+	words := tgseg.Segment(strings.TrimSpace(*from))
+	if len(words) == 0 {
+		return false
+	}
+	var word string
+	if left {
+		word, words = words[len(words)-1], words[0:len(words)-1]
+	} else {
+		word, words = words[0], words[1:]
+	}
+	sep := " "
+	if isCjkLang(tglang) {
+		sep = ""
+	}
+	*from = strings.TrimSpace(strings.Join(words, ""))
+	if left {
+		*to = strings.TrimSpace(word + sep + strings.TrimSpace(*to))
+	} else {
+		*to = strings.TrimSpace(strings.TrimSpace(*to) + sep + word)
+	}
+	joinSubLines(sub)
+	return true
+}
+
+func (r *reviewer) moveSplit(line int, left bool) {
+	if !moveSubSplit(r.tgseg, &r.subs[r.cur], line, left) {
+		r.message = reviewText("Give the line before the split point (not empty), e.g. < 1",
+			"请输入切分点前一行(不为空)的行号，例如 < 1")
+		return
+	}
+	touchSub(&r.subs[r.cur], "post-edited", true)
+	r.modified = true
+}
+
+//保存到json文件并重新生成字幕
+func (r *reviewer) save() {
+	r.project.setSubs(r.subs)
+	saveProject(josnfilepath, r.project)
+	r.modified = false
+	//字幕未能生成时(如字幕文件已存在、-final 时有未批准的行)提示原因，继续审校
+	if rerr := renderProject(r.project); rerr != nil {
+		r.message = reviewText("Saved "+josnfilepath+", the subtitle was not generated: ",
+			"已保存 "+josnfilepath+"，未生成字幕: ") + rerr.Error()
+		return
+	}
+	r.message = reviewText("Saved ", "已保存 ") + josnfilepath
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMoveSubSplit(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		line  int
+		left  bool
+		ok    bool
+		lines []string
+	}{
+		{1, true, true, []string{"你", "要去哪里？"}},
+		{1, false, true, []string{"你要去", "哪里？"}},
+		{0, true, false, []string{"你要", "去哪里？"}},
+		{2, true, false, []string{"你要", "去哪里？"}},
+	}
+	for _, tt := range tests {
+		sub := testSubs()[1]
+		if ok := moveSubSplit(runeSegmenter{}, &sub, tt.line, tt.left); ok != tt.ok {
+			t.Errorf("moveSubSplit(%d, %v) = %v, want %v", tt.line, tt.left, ok, tt.ok)
+		}
+		for k, want := range tt.lines {
+			if sub.SplitInfo[k].SCSub != want {
+				t.Errorf("moveSubSplit(%d, %v): line %d = %q, want %q", tt.line, tt.left, k+1, sub.SplitInfo[k].SCSub, want)
+			}
+		}
+		if sub.DCSub != "你要去哪里？" || sub.DCHash != subHash(sub.DCSub) {
+			t.Errorf("moveSubSplit(%d, %v): sentence %q hash %s", tt.line, tt.left, sub.DCSub, sub.DCHash)
+		}
+	}
+}
+
+//字幕未能生成时保存json文件并继续审校
+func TestReviewSave(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		force     bool
+		generated bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		bforce = tt.force
+		josnfilepath = writeTestProject(t, testSubs())
+		chspath := jsonChsFileName(josnfilepath)
+		if werr := ioutil.WriteFile(chspath, []byte("existing"), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+		var out bytes.Buffer
+		r := &reviewer{
+			project: readProject(josnfilepath),
+			srcseg:  enSegmenter{},
+			tgseg:   runeSegmenter{},
+			in:      bufio.NewReader(strings.NewReader("e 1\n您好。\ns\nn\nq\n")),
+			out:     &out,
+		}
+		r.subs = r.project.subs()
+		r.run()
+
+		if text := readProject(josnfilepath).Cues[0].Translation; text != "您好。" {
+			t.Errorf("-force=%v: saved translation %q, want %q", tt.force, text, "您好。")
+		}
+		data, _ := ioutil.ReadFile(chspath)
+		if generated := strings.Contains(string(data), "您好。"); generated != tt.generated {
+			t.Errorf("-force=%v: subtitle generated %v, want %v", tt.force, generated, tt.generated)
+		}
+		if failed := strings.Contains(out.String(), "the subtitle was not generated"); failed == tt.generated {
+			t.Errorf("-force=%v: error reported %v", tt.force, failed)
+		}
+		if !strings.Contains(out.String(), "Sentence 2/2") {
+			t.Errorf("-force=%v: the review did not continue after saving", tt.force)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//听障字幕(SDH)的说话人及声音描述，如 "JOHN: Where are you?" "[DOOR SLAMS]" "(laughs)"
+//-sdh strip 删除声音描述；translate 按 -sdhdict 翻译声音描述；keep 保留原文
+//声音描述及说话人均不写入.en.txt，生成字幕时再加到各行字幕中
+type sdhInfo struct {
+	//同一行字幕中有多个说话人时用 / 分隔
+	Speaker string     `json:"speaker,omitempty"`
+	Sounds  []sdhSound `json:"sounds,omitempty"`
+}
+
+type sdhSound struct {
+	Original    string `json:"original"`
+	Translation string `json:"translation,omitempty"`
+	//位于对白之后
+	After bool `json:"after,omitempty"`
+}
+
+var (
+	//括号内至少有一个字母，(1) [...] 等不是声音描述
+	sdhSoundReg   = regexp.MustCompile(`\[[^\]]*\pL[^\]]*\]|\([^)]*\pL[^)]*\)|^[♪♫#\s]+$`)
+	sdhSpeakerReg = regexp.MustCompile(`^\s*(-\s*)?(\p{Lu}[\p{Lu}\p{N}#&'’. ]*):(\s+|$)`)
+	//对白的破折号，如 "- JOHN: Hi. - MARY: Bye."
+	sdhDashReg = regexp.MustCompile(`(^|\s)-\s*`)
+	sdhDict    map[string]string
+	sdhMissing map[string]bool
+)
+
+func checkSdhMode() {
+	switch sdhmode {
+	case "", "strip", "translate", "keep":
+		return
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Unknown -sdh mode: "+sdhmode+" (strip translate keep)")
+	} else {
+		fmt.Fprintln(os.Stderr, "未知的 -sdh 处理方式: "+sdhmode+" (strip translate keep)")
+	}
+	os.Exit(1)
+}
+
+//声音描述词典：每行 原文=译文 或 原文<TAB>译文，不区分大小写，# 开头为注释
+func loadSdhDict() map[string]string {
+	if sdhDict != nil {
+		return sdhDict
+	}
+	sdhDict = make(map[string]string)
+	sdhMissing = make(map[string]bool)
+	if len(sdhdictpath) == 0 {
+		return sdhDict
+	}
+	data, _, rerr := readTextFile(sdhdictpath)
+	checkError(rerr)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.Index(line, "\t")
+		if sep < 0 {
+			sep = strings.Index(line, "=")
+		}
+		if sep <= 0 {
+			continue
+		}
+		sdhDict[sdhKey(line[0:sep])] = strings.TrimSpace(line[sep+1:])
+	}
+	return sdhDict
+}
+
+func sdhKey(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+//按词典翻译声音描述或说话人，保留括号，词典中没有时返回空字符串
+func translateSdh(text string) string {
+	inner, open, close := text, "", ""
+	if len(text) >= 2 && (text[0] == '[' || text[0] == '(') {
+		inner, open, close = text[1:len(text)-1], text[0:1], text[len(text)-1:]
+	}
+	translation, ok := loadSdhDict()[sdhKey(inner)]
+	if !ok {
+		sdhMissing[strings.TrimSpace(inner)] = true
+		return ""
+	}
+	return open + translation + close
+}
+
+//从一行原文中取出说话人及声音描述，返回对白，-sdh 为空时原样返回
+func extractSdh(text string, info *sdhInfo) string {
+	if len(sdhmode) == 0 {
+		return text
+	}
+	//一行中有多段以 - 开头的对白时，分别取出每段的说话人
+	bounds := []int{0}
+	for _, loc := range sdhDashReg.FindAllStringIndex(text, -1) {
+		if loc[0] > 0 {
+			bounds = append(bounds, loc[0])
+		}
+	}
+	bounds = append(bounds, len(text))
+	var dialogue strings.Builder
+	for i := 0; i+1 < len(bounds); i++ {
+		seg := text[bounds[i]:bounds[i+1]]
+		if m := sdhSpeakerReg.FindStringSubmatchIndex(seg); m != nil {
+			if len(info.Speaker) > 0 {
+				info.Speaker += "/"
+			}
+			info.Speaker += strings.TrimSpace(seg[m[4]:m[5]])
+			dash := ""
+			if m[2] >= 0 {
+				dash = seg[m[2]:m[3]]
+			}
+			seg = dash + seg[m[1]:]
+		}
+		dialogue.WriteString(" " + seg)
+	}
+	text = dialogue.String()
+	var b strings.Builder
+	last := 0
+	for _, loc := range sdhSoundReg.FindAllStringIndex(text, -1) {
+		b.WriteString(text[last:loc[0]])
+		last = loc[1]
+		if sdhmode == "strip" {
+			continue
+		}
+		sound := sdhSound{Original: strings.TrimSpace(text[loc[0]:loc[1]])}
+		sound.After = len(strings.Trim(b.String(), " -")) > 0
+		if sdhmode == "translate" && strings.ContainsAny(sound.Original[0:1], "[(") {
+			sound.Translation = translateSdh(sound.Original)
+		}
+		info.Sounds = append(info.Sounds, sound)
+	}
+	b.WriteString(text[last:])
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+//将一行原文的说话人及声音描述加到该行字幕中
+func addSdh(part *subpart, info sdhInfo) {
+	if len(info.Speaker) > 0 {
+		if len(part.SDH.Speaker) > 0 {
+			part.SDH.Speaker += "/"
+		}
+		part.SDH.Speaker += info.Speaker
+	}
+	part.SDH.Sounds = append(part.SDH.Sounds, info.Sounds...)
+}
+
+//生成字幕时加上说话人及声音描述，target 为 true 时使用声音描述的译文
+func sdhText(info sdhInfo, text string, target bool) string {
+	if len(info.Speaker) == 0 && len(info.Sounds) == 0 {
+		return text
+	}
+	var before, after []string
+	for _, sound := range info.Sounds {
+		s := sound.Original
+		if target && len(sound.Translation) > 0 {
+			s = sound.Translation
+		}
+		if sound.After {
+			after = append(after, s)
+		} else {
+			before = append(before, s)
+		}
+	}
+	speaker, sep := info.Speaker, ": "
+	if target {
+		speaker = sdhSpeaker(speaker)
+		if isCjkLang(tglang) {
+			sep = "："
+		}
+	}
+	//多个说话人且对白的破折号数目相同时，说话人分别加在各段对白前
+	if dialogue, ok := dashSpeakers(text, speaker, sep); ok {
+		text, speaker = dialogue, ""
+	}
+	words := append(before, strings.TrimSpace(text))
+	words = append(words, after...)
+	line := strings.Join(strings.Fields(strings.Join(words, " ")), " ")
+	if len(speaker) > 0 {
+		line = speaker + sep + line
+	}
+	return line
+}
+
+func dashSpeakers(text, speaker, sep string) (string, bool) {
+	names := strings.Split(speaker, "/")
+	text = strings.TrimSpace(text)
+	if len(names) < 2 || !strings.HasPrefix(text, "-") || len(sdhDashReg.FindAllStringIndex(text, -1)) != len(names) {
+		return text, false
+	}
+	k := 0
+	return sdhDashReg.ReplaceAllStringFunc(text, func(dash string) string {
+		k++
+		return strings.TrimRight(dash, " ") + " " + names[k-1] + sep
+	}), true
+}
+
+//说话人按词典翻译，词典中没有时保留原文；没有 -sdhdict 时译文不加说话人
+func sdhSpeaker(speaker string) string {
+	if sdhmode != "translate" || len(speaker) == 0 {
+		return speaker
+	}
+	if len(sdhdictpath) == 0 {
+		return ""
+	}
+	names := strings.Split(speaker, "/")
+	for i, name := range names {
+		if translation, ok := loadSdhDict()[sdhKey(name)]; ok {
+			names[i] = translation
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+//只有声音描述的行不参与译文切分
+func soundOnly(part subpart) bool {
+	return len(strings.TrimSpace(part.SSub)) == 0 && len(part.SDH.Sounds) > 0
+}
+
+//句子中有只有声音描述的行时，只将译文切分到有对白的行中，没有这样的行时返回 false
+func splitDialogueLines(srcseg, tgseg Segmenter, cursub *subInfo) bool {
+	var dialogue []int
+	for i, part := range cursub.SplitInfo {
+		if !soundOnly(part) {
+			dialogue = append(dialogue, i)
+		}
+	}
+	if len(dialogue) == len(cursub.SplitInfo) || len(dialogue) == 0 {
+		return false
+	}
+	lines := *cursub
+	lines.SplitInfo = nil
+	for _, i := range dialogue {
+		lines.SplitInfo = append(lines.SplitInfo, cursub.SplitInfo[i])
+	}
+	lines.MNum = len(dialogue)
+	splitSubLine(srcseg, tgseg, &lines)
+	for k, i := range dialogue {
+		cursub.SplitInfo[i].SCSub = lines.SplitInfo[k].SCSub
+	}
+	for i := range cursub.SplitInfo {
+		if soundOnly(cursub.SplitInfo[i]) {
+			cursub.SplitInfo[i].SCSub = ""
+		}
+	}
+	cursub.DCHash = lines.DCHash
+	return true
+}
+
+//-sdh translate 时提示词典中没有的声音描述
+func reportSdhMissing() {
+	if len(sdhMissing) == 0 {
+		return
+	}
+	var list []string
+	for text := range sdhMissing {
+		list = append(list, text)
+	}
+	sort.Strings(list)
+	if len(list) > 20 {
+		list = append(list[0:20], "...")
+	}
+	printWarning(strconv.Itoa(len(sdhMissing))+" sound descriptions are not in the -sdhdict file and were kept untranslated: "+strings.Join(list, ", "),
+		strconv.Itoa(len(sdhMissing))+" 个声音描述不在 -sdhdict 词典中，保留原文: "+strings.Join(list, ", "))
+	sdhMissing = make(map[string]bool)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//测试用的声音描述词典，结束时恢复
+func keepSdh(t *testing.T, mode string) {
+	oldmode, oldpath, olddict, oldmissing, oldtg := sdhmode, sdhdictpath, sdhDict, sdhMissing, tglang
+	t.Cleanup(func() {
+		sdhmode, sdhdictpath, sdhDict, sdhMissing, tglang = oldmode, oldpath, olddict, oldmissing, oldtg
+	})
+	sdhdictpath = filepath.Join(t.TempDir(), "sdh.txt")
+	if werr := ioutil.WriteFile(sdhdictpath, []byte("# sounds\ndoor  slams=门砰地关上\nlaughs\t笑\nJOHN=约翰\n"), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	sdhmode, sdhDict, sdhMissing = mode, nil, nil
+}
+
+func TestExtractSdh(t *testing.T) {
+	tests := []struct {
+		mode string
+		text string
+		want string
+		info sdhInfo
+	}{
+		{"", "JOHN: [DOOR SLAMS] Hi.", "JOHN: [DOOR SLAMS] Hi.", sdhInfo{}},
+		{"strip", "JOHN: [DOOR SLAMS] Hi.", "Hi.", sdhInfo{Speaker: "JOHN"}},
+		{"keep", "- MARY: Hi. (laughs)", "- Hi.", sdhInfo{Speaker: "MARY", Sounds: []sdhSound{{Original: "(laughs)", After: true}}}},
+		{"translate", "[Door slams] Hi.", "Hi.", sdhInfo{Sounds: []sdhSound{{Original: "[Door slams]", Translation: "[门砰地关上]"}}}},
+		{"translate", "[SIGHS]", "", sdhInfo{Sounds: []sdhSound{{Original: "[SIGHS]"}}}},
+		{"translate", "♪ ♪", "", sdhInfo{Sounds: []sdhSound{{Original: "♪ ♪"}}}},
+		{"strip", "Ok: fine.", "Ok: fine.", sdhInfo{}},
+		{"keep", "- JOHN: Hi. - MARY: Bye.", "- Hi. - Bye.", sdhInfo{Speaker: "JOHN/MARY"}},
+		{"strip", "Chapter (1) [...] [SIGHS]", "Chapter (1) [...]", sdhInfo{}},
+	}
+	for _, tt := range tests {
+		keepSdh(t, tt.mode)
+		var info sdhInfo
+		if got := extractSdh(tt.text, &info); got != tt.want || !reflect.DeepEqual(info, tt.info) {
+			t.Errorf("-sdh %q extractSdh(%q) = %q %+v, want %q %+v", tt.mode, tt.text, got, info, tt.want, tt.info)
+		}
+	}
+}
+
+//生成字幕时译文使用声音描述及说话人的译文，原文保留原样
+func TestSdhText(t *testing.T) {
+	keepSdh(t, "translate")
+	info := sdhInfo{Speaker: "JOHN", Sounds: []sdhSound{{Original: "[DOOR SLAMS]", Translation: "[门砰地关上]"}, {Original: "(SIGHS)", After: true}}}
+	tests := []struct {
+		lang   string
+		text   string
+		target bool
+		want   string
+	}{
+		{"zh", "你好。", true, "约翰：[门砰地关上] 你好。 (SIGHS)"},
+		{"fr", "Salut.", true, "约翰: [门砰地关上] Salut. (SIGHS)"},
+		{"zh", "Hi.", false, "JOHN: [DOOR SLAMS] Hi. (SIGHS)"},
+	}
+	for _, tt := range tests {
+		tglang = tt.lang
+		if got := sdhText(info, tt.text, tt.target); got != tt.want {
+			t.Errorf("sdhText(%q, %s, %v) = %q, want %q", tt.text, tt.lang, tt.target, got, tt.want)
+		}
+	}
+	if got := sdhText(sdhInfo{}, "你好。", true); got != "你好。" {
+		t.Errorf("sdhText without SDH = %q", got)
+	}
+	tglang = "zh"
+	dialogue := sdhInfo{Speaker: "JOHN/MARY"}
+	if got := sdhText(dialogue, "- 你好。 - 再见。", true); got != "- 约翰：你好。 - MARY：再见。" {
+		t.Errorf("sdhText with two speakers = %q", got)
+	}
+	if got := sdhText(dialogue, "你好，再见。", true); got != "约翰/MARY：你好，再见。" {
+		t.Errorf("sdhText with two speakers and no dashes = %q", got)
+	}
+	//没有 -sdhdict 时不将英文说话人加到译文中
+	sdhdictpath, sdhDict = "", nil
+	if got := sdhText(info, "你好。", true); got != "[门砰地关上] 你好。 (SIGHS)" {
+		t.Errorf("sdhText without -sdhdict = %q", got)
+	}
+	if got := sdhText(info, "Hi.", false); got != "JOHN: [DOOR SLAMS] Hi. (SIGHS)" {
+		t.Errorf("sdhText original without -sdhdict = %q", got)
+	}
+}
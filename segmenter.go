@@ -0,0 +1,196 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//分词接口，返回的分词结果中保留空格，每个空白字符为一个 " " 分词
+type Segmenter interface {
+	Segment(text string) []string
+}
+
+//语言设置，确定该语言使用的分词方式
+type langProfile struct {
+	Name         string
+	NewSegmenter func() Segmenter
+}
+
+var langProfiles = map[string]langProfile{
+	"zh": {"Chinese", func() Segmenter { return loadSegmenter() }},
+	"en": {"English", func() Segmenter { return enSegmenter{} }},
+	"ja": {"Japanese", func() Segmenter { return loadJaSegmenter() }},
+}
+
+//根据语言代码获取分词方式，未知语言按字切分
+func langSegmenter(lang string) Segmenter {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[0:i]
+	}
+	if profile, ok := langProfiles[lang]; ok {
+		return profile.NewSegmenter()
+	}
+	return runeSegmenter{}
+}
+
+//英文分词，按空格和标点符号切分；撇号单独作为一个分词
+type enSegmenter struct{}
+
+func (enSegmenter) Segment(text string) []string {
+	var tokens []string
+	rtext := []rune(text)
+	word := ""
+	for i := 0; i < len(rtext); i++ {
+		r := rtext[i]
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word += string(r)
+			continue
+		}
+		//数字中的小数点及千位分隔符，如 3.5 1,000
+		if (r == '.' || r == ',') && len(word) > 0 && i+1 < len(rtext) &&
+			unicode.IsDigit(rtext[i-1]) && unicode.IsDigit(rtext[i+1]) {
+			word += string(r)
+			continue
+		}
+		if len(word) > 0 {
+			tokens = append(tokens, word)
+			word = ""
+		}
+		if unicode.IsSpace(r) {
+			tokens = append(tokens, " ")
+		} else {
+			tokens = append(tokens, string(r))
+		}
+	}
+	if len(word) > 0 {
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+//日文分词，按词典最长匹配，未登录词按文字类型(汉字、平假名、片假名等)切分
+type jaSegmenter struct {
+	words  map[string]bool
+	maxLen int
+}
+
+// 内置日文词典
+//
+//go:embed dict/ja.txt
+var jaDictionary string
+
+var (
+	jaSeg     *jaSegmenter
+	jaSegOnce sync.Once
+)
+
+func loadJaSegmenter() *jaSegmenter {
+	jaSegOnce.Do(func() {
+		jaSeg = &jaSegmenter{words: make(map[string]bool)}
+		for _, word := range strings.Split(jaDictionary, "\n") {
+			word = strings.TrimSpace(word)
+			if len(word) == 0 {
+				continue
+			}
+			jaSeg.words[word] = true
+			if n := len([]rune(word)); n > jaSeg.maxLen {
+				jaSeg.maxLen = n
+			}
+		}
+	})
+	return jaSeg
+}
+
+//文字类型
+const (
+	scriptOther = iota
+	scriptSpace
+	scriptPunct
+	scriptHan
+	scriptHiragana
+	scriptKatakana
+	scriptLatin
+)
+
+func runeScript(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return scriptSpace
+	case unicode.Is(unicode.Han, r):
+		return scriptHan
+	case unicode.Is(unicode.Hiragana, r):
+		return scriptHiragana
+	case unicode.Is(unicode.Katakana, r) || r == 'ー':
+		return scriptKatakana
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		return scriptLatin
+	case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		return scriptPunct
+	}
+	return scriptOther
+}
+
+func (s *jaSegmenter) Segment(text string) []string {
+	var tokens []string
+	rtext := []rune(text)
+	for i := 0; i < len(rtext); {
+		script := runeScript(rtext[i])
+		if script == scriptSpace {
+			tokens = append(tokens, " ")
+			i++
+			continue
+		}
+		if script == scriptPunct || script == scriptOther {
+			tokens = append(tokens, string(rtext[i]))
+			i++
+			continue
+		}
+
+		//词典最长匹配
+		wlen := 0
+		for n := s.maxLen; n > 0; n-- {
+			if i+n <= len(rtext) && s.words[string(rtext[i:i+n])] {
+				wlen = n
+				break
+			}
+		}
+		//未登录词，取同类文字，遇到词典中的词时结束
+		if wlen == 0 {
+			wlen = 1
+			for i+wlen < len(rtext) && runeScript(rtext[i+wlen]) == script &&
+				!s.startsWord(rtext[i+wlen:]) {
+				wlen++
+			}
+		}
+		tokens = append(tokens, string(rtext[i:i+wlen]))
+		i += wlen
+	}
+	return tokens
+}
+
+func (s *jaSegmenter) startsWord(rtext []rune) bool {
+	for n := s.maxLen; n > 0; n-- {
+		if n <= len(rtext) && s.words[string(rtext[0:n])] {
+			return true
+		}
+	}
+	return false
+}
+
+//按字切分，用于未知语言
+type runeSegmenter struct{}
+
+func (runeSegmenter) Segment(text string) []string {
+	var tokens []string
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			tokens = append(tokens, " ")
+		} else {
+			tokens = append(tokens, string(r))
+		}
+	}
+	return tokens
+}
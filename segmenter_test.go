@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSegmenters(t *testing.T) {
+	tests := []struct {
+		lang string
+		text string
+		want []string
+	}{
+		{"en", "I don't know.", []string{"I", " ", "don", "'", "t", " ", "know", "."}},
+		{"en-US", "It's 1,000  dollars", []string{"It", "'", "s", " ", "1,000", " ", " ", "dollars"}},
+		{"en", "3.5.", []string{"3.5", "."}},
+		{"ja", "どこへ行くの？", []string{"どこ", "へ", "行く", "の", "？"}},
+		{"ja_JP", "テレビを見る", []string{"テレビ", "を", "見る"}},
+		{"ko", "안녕 하세요", []string{"안", "녕", " ", "하", "세", "요"}},
+	}
+	for _, tt := range tests {
+		if got := langSegmenter(tt.lang).Segment(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Segment(%q) = %q, want %q", tt.lang, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLangSegmenter(t *testing.T) {
+	tests := []struct {
+		lang string
+		want Segmenter
+	}{
+		{"en", enSegmenter{}},
+		{"EN-gb", enSegmenter{}},
+		{"ja", loadJaSegmenter()},
+		{"fr", runeSegmenter{}},
+		{"", runeSegmenter{}},
+	}
+	for _, tt := range tests {
+		if got := langSegmenter(tt.lang); reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+			t.Errorf("langSegmenter(%q) = %T, want %T", tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 网页审校界面，不使用外部资源
+//
+//go:embed web/review.html
+var reviewHTML []byte
+
+//网页审校：各句字幕及各行的检查结果
+type webLine struct {
+	Pos         int      `json:"pos"`
+	Time        string   `json:"time"`
+	Original    string   `json:"original"`
+	Translation string   `json:"translation"`
+	Cps         float64  `json:"cps"`
+	Warnings    []string `json:"warnings"`
+}
+
+type webCue struct {
+	Index       int       `json:"index"`
+	Pos         int       `json:"pos"`
+	State       string    `json:"state"`
+	Flow        string    `json:"flow"`
+	Comments    []string  `json:"comments"`
+	Original    string    `json:"original"`
+	Translation string    `json:"translation"`
+	Lines       []webLine `json:"lines"`
+}
+
+type webProject struct {
+	Lang   string   `json:"lang"`
+	File   string   `json:"file"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	MaxCps float64  `json:"maxCps"`
+	MaxLen int      `json:"maxLen"`
+	Cues   []webCue `json:"cues"`
+}
+
+//修改请求：translation 修改整句译文，line 及 text 修改一行译文，split 及 left 移动切分点
+type webEdit struct {
+	Index       int     `json:"index"`
+	Translation *string `json:"translation"`
+	Line        int     `json:"line"`
+	Text        *string `json:"text"`
+	Split       int     `json:"split"`
+	Left        bool    `json:"left"`
+}
+
+type reviewServer struct {
+	mu      sync.Mutex
+	project *subProject
+	subs    []subInfo
+	srcseg  Segmenter
+	tgseg   Segmenter
+}
+
+func newWebCue(i int, sub subInfo) webCue {
+	cue := webCue{Index: i, Pos: sub.DPos, State: cueState(sub), Original: strings.TrimSpace(sub.DESub),
+		Translation: sub.DCSub, Flow: strings.TrimSpace(flowText(sub.Flow)), Lines: []webLine{}}
+	cue.Comments = append([]string{}, commentLines("#", sub.Flow)...)
+	for _, part := range sub.SplitInfo {
+		cue.Comments = append(cue.Comments, commentLines("#"+strconv.Itoa(part.SPos+1), part.Flow)...)
+	}
+	for _, part := range sub.SplitInfo {
+		_, cps := lineCps(part)
+		warnings := lineWarnings(part)
+		if warnings == nil {
+			warnings = []string{}
+		}
+		cue.Lines = append(cue.Lines, webLine{part.SPos, part.STime, part.SSub, part.SCSub, cps, warnings})
+	}
+	return cue
+}
+
+func (s *reviewServer) webProject() webProject {
+	maxcps, maxlen := reviewLimits(tglang)
+	wp := webProject{Lang: slang, File: josnfilepath, Source: srclang, Target: tglang, MaxCps: maxcps, MaxLen: maxlen, Cues: []webCue{}}
+	for i, sub := range s.subs {
+		wp.Cues = append(wp.Cues, newWebCue(i, sub))
+	}
+	return wp
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+//仅接受本机地址的请求，修改请求需要自定义请求头，防止其它网页跨站修改
+var loopbackHostReg = regexp.MustCompile(`^(localhost|127\.\d+\.\d+\.\d+|\[::1\])(:\d+)?$`)
+
+func (s *reviewServer) guard(loopback bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if loopback && !loopbackHostReg.MatchString(req.Host) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		if req.Method != http.MethodGet && req.Header.Get("X-TrSubtitle") != "1" {
+			http.Error(w, "missing X-TrSubtitle header", http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
+
+func (s *reviewServer) handleIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(reviewHTML)
+}
+
+func (s *reviewServer) handleProject(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, s.webProject())
+}
+
+//修改一句字幕，保存json文件并返回修改后的句子
+func (s *reviewServer) handleEdit(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	var edit webEdit
+	if derr := json.NewDecoder(req.Body).Decode(&edit); derr != nil {
+		http.Error(w, derr.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if edit.Index < 0 || edit.Index >= len(s.subs) {
+		http.Error(w, "no such sentence", http.StatusBadRequest)
+		return
+	}
+	sub := &s.subs[edit.Index]
+	before := subTexts(*sub)
+	switch {
+	case edit.Translation != nil:
+		sub.DCSub = strings.TrimSpace(*edit.Translation)
+		splitSubLine(s.srcseg, s.tgseg, sub)
+	case edit.Text != nil:
+		if edit.Line < 1 || edit.Line > len(sub.SplitInfo) {
+			http.Error(w, "no such line", http.StatusBadRequest)
+			return
+		}
+		sub.SplitInfo[edit.Line-1].SCSub = strings.TrimSpace(*edit.Text)
+		joinSubLines(sub)
+	case edit.Split > 0:
+		if !moveSubSplit(s.tgseg, sub, edit.Split, edit.Left) {
+			http.Error(w, "cannot move the split point", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "nothing to change", http.StatusBadRequest)
+		return
+	}
+	touchSub(sub, "post-edited", subTexts(*sub) != before)
+	s.project.setSubs(s.subs)
+	//保存或生成字幕失败时返回错误，不中止审校服务
+	if serr := writeProject(josnfilepath, s.project); serr != nil {
+		http.Error(w, "cannot save the json file: "+serr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rerr := renderProject(s.project); rerr != nil {
+		http.Error(w, "saved, but the subtitle was not generated: "+rerr.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, newWebCue(edit.Index, *sub))
+}
+
+//下载生成的字幕，srt 与 -jsfile 生成的字幕相同
+func (s *reviewServer) handleDownload(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := subBaseName(josnfilepath) + "." + langTag(tglang)
+	if strings.HasSuffix(req.URL.Path, ".ass") {
+		w.Header().Set("Content-Type", "text/x-ssa; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.ass"`)
+		w.Write([]byte(assSubText(s.subs, subBaseName(josnfilepath))))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.srt"`)
+	w.Write([]byte(jsonSubText(s.subs)))
+}
+
+//在本机启动网页审校界面，-addr 默认只绑定 127.0.0.1
+func ServeProject() {
+	checkJsonFile()
+	if josnfilepath == "-" {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "-serve needs a json file.")
+		} else {
+			fmt.Fprintln(os.Stderr, "-serve 需要json文件.")
+		}
+		os.Exit(1)
+	}
+	s := &reviewServer{
+		project: readProject(josnfilepath),
+		srcseg:  langSegmenter(srclang),
+		tgseg:   langSegmenter(tglang),
+	}
+	s.subs = s.project.subs()
+	checkProjectSource(s.project)
+
+	host, _, serr := net.SplitHostPort(serveaddr)
+	checkError(serr)
+	ip := net.ParseIP(host)
+	loopback := host == "localhost" || (ip != nil && ip.IsLoopback())
+	if !loopback {
+		printWarning("The review page is reachable from other computers: "+serveaddr,
+			"其它计算机也可以访问审校网页: "+serveaddr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.guard(loopback, s.handleIndex))
+	mux.HandleFunc("/api/project", s.guard(loopback, s.handleProject))
+	mux.HandleFunc("/api/edit", s.guard(loopback, s.handleEdit))
+	mux.HandleFunc("/download.srt", s.guard(loopback, s.handleDownload))
+	mux.HandleFunc("/download.ass", s.guard(loopback, s.handleDownload))
+
+	listener, lerr := net.Listen("tcp", serveaddr)
+	checkError(lerr)
+	url := "http://" + listener.Addr().String() + "/"
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Review "+josnfilepath+" at "+url+" (Ctrl+C to stop)")
+	} else {
+		fmt.Fprintln(os.Stderr, "请在浏览器中打开 "+url+" 审校 "+josnfilepath+" (Ctrl+C 结束)")
+	}
+	checkError(http.Serve(listener, mux))
+}
+
+//ASS时间 0:00:01.50
+func assTime(srttime string) string {
+	ms, ok := parseSrtTime(srttime)
+	if !ok {
+		return "0:00:00.00"
+	}
+	cs := ms / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+var assTagReplacer = strings.NewReplacer("<i>", `{\i1}`, "</i>", `{\i0}`, "<b>", `{\b1}`, "</b>", `{\b0}`,
+	"<u>", `{\u1}`, "</u>", `{\u0}`, "\r", "", "\n", `\N`)
+
+func assText(text string) string {
+	return htmlTagReg.ReplaceAllString(assTagReplacer.Replace(strings.TrimSpace(text)), "")
+}
+
+//生成ASS字幕，双语字幕的原文字号较小
+func assSubText(subs []subInfo, title string) string {
+	var b strings.Builder
+	b.WriteString("[Script Info]\nTitle: " + title + "\nScriptType: v4.00+\nWrapStyle: 0\nPlayResX: 1920\nPlayResY: 1080\n\n")
+	b.WriteString("[V4+ Styles]\n")
+	b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, " +
+		"Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	b.WriteString("Style: Default,Arial,64,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,1,2,40,40,40,1\n\n")
+	b.WriteString("[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	dialogue := func(timeline, text string) {
+		start, end := splitTimeline(timeline)
+		b.WriteString("Dialogue: 0," + assTime(start) + "," + assTime(end) + ",Default,,0,0,0,," + text + "\n")
+	}
+	lines := strings.Split(jsfirstext, "\n")
+	dialogue(lines[1], lines[2]+`\N`+lines[3])
+	for _, sub := range subs {
+		for _, part := range sub.SplitInfo {
+			text := assText(cueStyle(sub.Type, sdhText(part.SDH, part.SCSub, true), true))
+			if sstype == "b" && cueTranslated(sub.Type) {
+				text += `\N{\fs44}` + assText(cueStyle(sub.Type, sdhText(part.SDH, part.SSub, false), false))
+			}
+			dialogue(part.STime, text)
+		}
+	}
+	return b.String()
+}
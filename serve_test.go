@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//仅接受本机地址的请求，修改请求需要 X-TrSubtitle 请求头
+func TestReviewGuard(t *testing.T) {
+	s := &reviewServer{}
+	handler := s.guard(true, func(w http.ResponseWriter, req *http.Request) {})
+	tests := []struct {
+		method string
+		host   string
+		header bool
+		want   int
+	}{
+		{http.MethodGet, "127.0.0.1:8080", false, http.StatusOK},
+		{http.MethodGet, "localhost:8080", false, http.StatusOK},
+		{http.MethodGet, "[::1]:8080", false, http.StatusOK},
+		{http.MethodGet, "evil.example:8080", false, http.StatusForbidden},
+		{http.MethodPost, "127.0.0.1:8080", false, http.StatusForbidden},
+		{http.MethodPost, "127.0.0.1:8080", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/edit", nil)
+		req.Host = tt.host
+		if tt.header {
+			req.Header.Set("X-TrSubtitle", "1")
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s header %v: status %d, want %d", tt.method, tt.host, tt.header, w.Code, tt.want)
+		}
+	}
+}
+
+//修改后保存json文件，译文改变时审校状态改为 post-edited
+func TestReviewEdit(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		body   string
+		want   int
+		lines  []string
+		status string
+	}{
+		{`{"index": 1, "line": 2, "text": "去哪儿？"}`, http.StatusOK, []string{"你要", "去哪儿？"}, "post-edited"},
+		{`{"index": 1, "split": 1, "left": false}`, http.StatusOK, []string{"你要去", "哪里？"}, "post-edited"},
+		{`{"index": 1, "line": 2, "text": "去哪里？"}`, http.StatusOK, []string{"你要", "去哪里？"}, "reviewed"},
+		{`{"index": 1, "line": 3, "text": "?"}`, http.StatusBadRequest, []string{"你要", "去哪里？"}, "reviewed"},
+		{`{"index": 2, "translation": "?"}`, http.StatusBadRequest, nil, ""},
+		{`{"index": 1}`, http.StatusBadRequest, []string{"你要", "去哪里？"}, "reviewed"},
+		{`{"index": `, http.StatusBadRequest, nil, ""},
+	}
+	for _, tt := range tests {
+		subs := testSubs()
+		subs[1].Flow.Status = "reviewed"
+		josnfilepath = writeTestProject(t, subs)
+		s := &reviewServer{project: readProject(josnfilepath), srcseg: enSegmenter{}, tgseg: runeSegmenter{}}
+		s.subs = s.project.subs()
+		w := httptest.NewRecorder()
+		s.handleEdit(w, httptest.NewRequest(http.MethodPost, "/api/edit", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.body, w.Code, tt.want)
+		}
+		if tt.lines == nil {
+			continue
+		}
+		saved := readProject(josnfilepath).subs()[1]
+		for k, want := range tt.lines {
+			if saved.SplitInfo[k].SCSub != want {
+				t.Errorf("%s: line %d = %q, want %q", tt.body, k+1, saved.SplitInfo[k].SCSub, want)
+			}
+		}
+		if saved.Flow.Status != tt.status {
+			t.Errorf("%s: status %q, want %q", tt.body, saved.Flow.Status, tt.status)
+		}
+	}
+}
+
+//保存或生成字幕失败时返回 500，服务不中止
+func TestReviewEditErrors(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		name  string
+		setup func()
+		want  string
+	}{
+		{"save", func() { josnfilepath = filepath.Join(t.TempDir(), "missing", "Movie.srt.json") }, "cannot save the json file"},
+		{"render", func() { bfinal = true }, "the subtitle was not generated"},
+	}
+	for _, tt := range tests {
+		bfinal = false
+		josnfilepath = writeTestProject(t, testSubs())
+		s := &reviewServer{project: readProject(josnfilepath), srcseg: enSegmenter{}, tgseg: runeSegmenter{}}
+		s.subs = s.project.subs()
+		tt.setup()
+		w := httptest.NewRecorder()
+		s.handleEdit(w, httptest.NewRequest(http.MethodPost, "/api/edit", strings.NewReader(`{"index": 1, "line": 2, "text": "去哪儿？"}`)))
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: status %d %q, want 500 %q", tt.name, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestAssText(t *testing.T) {
+	tests := []struct {
+		srttime string
+		time    string
+		text    string
+		ass     string
+	}{
+		{"00:00:01,500", "0:00:01.50", "<i>Hi</i>\nthere", `{\i1}Hi{\i0}\Nthere`},
+		{"01:02:03,456", "1:02:03.45", `<font color="red">red</font>`, "red"},
+		{"bad", "0:00:00.00", " {\\an8}top ", `{\an8}top`},
+	}
+	for _, tt := range tests {
+		if got := assTime(tt.srttime); got != tt.time {
+			t.Errorf("assTime(%q) = %q, want %q", tt.srttime, got, tt.time)
+		}
+		if got := assText(tt.text); got != tt.ass {
+			t.Errorf("assText(%q) = %q, want %q", tt.text, got, tt.ass)
+		}
+	}
+}
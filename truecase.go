@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//恢复全大写或全小写原文字幕的大小写：
+//词的写法取自用户词典(-udict)或语料中出现最多的写法(句首的词不计)，未出现过的词为小写，句首的词首字母大写
+type trueCaser struct {
+	forms    map[string]map[string]int
+	glossary map[string]string
+	start    bool
+}
+
+//语料少于此词数时标点及大小写的结果不可靠，提示警告
+const minCorpusWords = 20000
+
+var (
+	//标签原样保留，不作为词处理
+	truecaseTokenReg = regexp.MustCompile(`<[^>]*>|\{[^}]*\}|[\p{L}\p{N}]+(?:['’][\p{L}\p{N}]+)*`)
+	//句末标点，其后可以是对话的 -
+	sentenceEndReg = regexp.MustCompile(`[.?!…。？！]["'’”)\]]*\s*(?:-\s*)?$`)
+)
+
+func newTrueCaser() *trueCaser {
+	return &trueCaser{forms: make(map[string]map[string]int), glossary: make(map[string]string)}
+}
+
+func isTag(token string) bool {
+	return strings.HasPrefix(token, "<") || strings.HasPrefix(token, "{")
+}
+
+//统计语料中各词的写法，返回词数
+func (tc *trueCaser) learn(text string) int {
+	words := 0
+	start := true
+	for _, line := range strings.Split(text, "\n") {
+		last := 0
+		for _, loc := range truecaseTokenReg.FindAllStringIndex(line, -1) {
+			token := line[loc[0]:loc[1]]
+			if sentenceEndReg.MatchString(line[last:loc[0]]) || strings.HasPrefix(strings.TrimSpace(line[last:loc[0]]), "-") {
+				start = true
+			}
+			last = loc[1]
+			if isTag(token) {
+				continue
+			}
+			words++
+			if start {
+				start = false
+				continue
+			}
+			lower := strings.ToLower(token)
+			if tc.forms[lower] == nil {
+				tc.forms[lower] = make(map[string]int)
+			}
+			tc.forms[lower][token]++
+		}
+		start = start || sentenceEndReg.MatchString(line[last:])
+	}
+	return words
+}
+
+//用户词典中含大写字母的词按原写法使用
+func (tc *trueCaser) loadGlossary(path string) {
+	data, _, rerr := readTextFile(path)
+	if rerr != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.ToLower(fields[0]) != fields[0] {
+			tc.glossary[strings.ToLower(fields[0])] = fields[0]
+		}
+	}
+}
+
+//词的写法：用户词典、语料中最多的写法(相同时取小写)、小写
+func (tc *trueCaser) form(word string) string {
+	lower := strings.ToLower(word)
+	if form, ok := tc.glossary[lower]; ok {
+		return form
+	}
+	best, bestn := lower, 0
+	for form, n := range tc.forms[lower] {
+		if n > bestn || (n == bestn && form != best && (form == lower || (best != lower && form < best))) {
+			best, bestn = form, n
+		}
+	}
+	return best
+}
+
+func capitalizeFirst(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+//处理一行原文，句首状态延续到下一行
+func (tc *trueCaser) line(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range truecaseTokenReg.FindAllStringIndex(text, -1) {
+		token := text[loc[0]:loc[1]]
+		between := text[last:loc[0]]
+		b.WriteString(between)
+		last = loc[1]
+		if sentenceEndReg.MatchString(between) || strings.HasPrefix(strings.TrimSpace(between), "-") {
+			tc.start = true
+		}
+		if isTag(token) {
+			b.WriteString(token)
+			continue
+		}
+		word := tc.form(token)
+		if tc.start {
+			word = capitalizeFirst(word)
+			tc.start = false
+		}
+		b.WriteString(word)
+	}
+	b.WriteString(text[last:])
+	if sentenceEndReg.MatchString(text[last:]) {
+		tc.start = true
+	}
+	return b.String()
+}
+
+//字幕文本中的大小写字母比例：全大写或全小写(允许少量例外，如 I)时返回 true
+func needTruecase(text []byte) bool {
+	upper, lower := 0, 0
+	for _, line := range strings.Split(corpusText(text), "\n") {
+		for _, r := range htmlTagReg.ReplaceAllString(line, "") {
+			if unicode.IsUpper(r) {
+				upper++
+			} else if unicode.IsLower(r) {
+				lower++
+			}
+		}
+	}
+	letters := upper + lower
+	return letters > 0 && (upper*10 >= letters*9 || upper*50 <= letters)
+}
+
+//-truecase 时建立大小写模型：-tccorpus 语料(必须)及用户词典，原文大小写正常时返回 nil
+func loadTrueCaser(intext []byte) *trueCaser {
+	if !btruecase {
+		return nil
+	}
+	if !needTruecase(intext) {
+		printWarning("The subtitles are not all caps or all lowercase, -truecase was skipped.",
+			"原文字幕不是全大写或全小写，未恢复大小写.")
+		return nil
+	}
+	tc := newTrueCaser()
+	tc.start = true
+	words := 0
+	for _, pattern := range strings.Split(tccorpuspaths, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 {
+			printWarning("No corpus files found: "+pattern, "未发现语料文件: "+pattern)
+		}
+		for _, path := range matches {
+			data, _, rerr := readTextFile(path)
+			if rerr != nil {
+				printWarning(rerr.Error(), rerr.Error())
+				continue
+			}
+			words += tc.learn(corpusText(data))
+		}
+	}
+	if words == 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "-truecase requires -tccorpus: normally cased srt or text files, e.g. other episodes of the show.")
+		} else {
+			fmt.Fprintln(os.Stderr, "-truecase 需要 -tccorpus 参数: 大小写正常的srt或文本文件，如同一剧集的其它字幕.")
+		}
+		os.Exit(1)
+	}
+	if words < minCorpusWords {
+		printWarning("-tccorpus has only "+strconv.Itoa(words)+" words, words not found in it are written in lowercase.",
+			"-tccorpus 语料只有 "+strconv.Itoa(words)+" 个词，语料中没有的词为小写.")
+	}
+	for _, udict := range strings.Split(udictpaths, ",") {
+		if udict = strings.TrimSpace(udict); len(udict) > 0 {
+			tc.loadGlossary(udict)
+		}
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Restoring the case of the subtitles.")
+	} else {
+		fmt.Fprintln(os.Stderr, "正在恢复原文字幕的大小写.")
+	}
+	return tc
+}
+
+//添加标点后句首的词首字母大写，start 为该行是否从句首开始，返回下一行是否从句首开始
+func capitalizeSentences(text string, start bool) (string, bool) {
+	var b strings.Builder
+	last := 0
+	for _, loc := range truecaseTokenReg.FindAllStringIndex(text, -1) {
+		token := text[loc[0]:loc[1]]
+		between := text[last:loc[0]]
+		b.WriteString(between)
+		last = loc[1]
+		if sentenceEndReg.MatchString(between) {
+			start = true
+		}
+		if isTag(token) {
+			b.WriteString(token)
+			continue
+		}
+		if start {
+			token = capitalizeFirst(token)
+			start = false
+		}
+		b.WriteString(token)
+	}
+	b.WriteString(text[last:])
+	return b.String(), start || sentenceEndReg.MatchString(text[last:])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNeedTruecase(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"1\n00:00:01,000 --> 00:00:02,000\nWHERE ARE YOU GOING?\n", true},
+		{"where are you going? i don't know.\n", true},
+		{"<i>WHERE</i> ARE YOU GOING, I?\n", true},
+		{"Where are you going?\n", false},
+		{"123 456\n", false},
+	}
+	for _, tt := range tests {
+		if got := needTruecase([]byte(tt.text)); got != tt.want {
+			t.Errorf("needTruecase(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTrueCaser(t *testing.T) {
+	tc := newTrueCaser()
+	if words := tc.learn("Sheldon went to New York with Leonard.\nThen Sheldon said I am tired.\nThe end."); words != 15 {
+		t.Errorf("learn counted %d words, want 15", words)
+	}
+	tc.glossary["nasa"] = "NASA"
+	tc.start = true
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"SHELDON WENT TO NASA.", "Sheldon went to NASA."},
+		{"THEN <i>LEONARD</i> SAID", "Then <i>Leonard</i> said"},
+		{"I WENT TO NEW YORK. THE END", "I went to New York. The end"},
+		{"- WHAT? - NOTHING.", "- What? - Nothing."},
+	}
+	for _, tt := range tests {
+		if got := tc.line(tt.line); got != tt.want {
+			t.Errorf("line(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCapitalizeSentences(t *testing.T) {
+	tests := []struct {
+		text      string
+		start     bool
+		want      string
+		wantstart bool
+	}{
+		{"where are you going? home.", true, "Where are you going? Home.", true},
+		{"where are you", false, "where are you", false},
+		{"<i>yes.</i>", true, "<i>Yes.</i>", true},
+		{"going, i think", true, "Going, i think", false},
+	}
+	for _, tt := range tests {
+		got, start := capitalizeSentences(tt.text, tt.start)
+		if got != tt.want || start != tt.wantstart {
+			t.Errorf("capitalizeSentences(%q, %v) = %q, %v, want %q, %v", tt.text, tt.start, got, start, tt.want, tt.wantstart)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//监视目录内记录已处理文件的状态文件
+const watchStateName = ".trsubtitle-watch.json"
+
+//已处理文件的修改时间及大小，未变化的文件不再处理
+type watchFile struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+}
+
+type watchState struct {
+	path  string
+	Files map[string]watchFile `json:"files"`
+}
+
+//监视目录：出现新的原文字幕时生成待译原文，出现译文时合并生成字幕，
+//json文件修改后重新生成字幕
+func WatchFolder() {
+	fi, serr := os.Stat(watchdir)
+	if serr != nil || !fi.IsDir() {
+		if slang == "en" {
+			fmt.Fprint(os.Stderr, "No folder found:"+watchdir+"\n")
+		} else {
+			fmt.Fprint(os.Stderr, "未发现目录:"+watchdir+"\n")
+		}
+		os.Exit(1)
+	}
+	settle := time.Duration(watchinterval) * time.Second
+	if settle <= 0 {
+		settle = time.Second
+	}
+
+	state := loadWatchState(filepath.Join(watchdir, watchStateName))
+	exepath, args := batchChildArgs()
+
+	events := make(chan string, 64)
+	mode := startWatcher(watchdir, settle, events)
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Watching folder ("+mode+"): "+watchdir+"  Press Ctrl+C to stop.")
+	} else {
+		fmt.Fprintln(os.Stderr, "正在监视目录("+mode+"): "+watchdir+"  按 Ctrl+C 停止.")
+	}
+
+	//启动前已存在的文件也按状态文件检查一次
+	pending := make(map[string]time.Time)
+	for path := range scanWatchDir(watchdir) {
+		pending[path] = time.Time{}
+	}
+
+	ticker := time.NewTicker(settle / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case path := <-events:
+			pending[path] = time.Now()
+		case <-ticker.C:
+			//文件在 settle 时间内无变化后再处理，避免处理写入中的文件
+			var ready []string
+			for path, last := range pending {
+				if time.Since(last) >= settle {
+					ready = append(ready, path)
+				}
+			}
+			//先处理原文字幕，再处理译文及json文件
+			sort.Slice(ready, func(i, j int) bool {
+				return watchOrder(ready[i]) < watchOrder(ready[j]) ||
+					watchOrder(ready[i]) == watchOrder(ready[j]) && ready[i] < ready[j]
+			})
+			for _, path := range ready {
+				delete(pending, path)
+				processWatchFile(exepath, args, state, path)
+			}
+		}
+	}
+}
+
+func watchOrder(path string) int {
+	if isBatchSrt(path) {
+		return 0
+	}
+	return 1
+}
+
+//按文件类型确定处理方式，已处理且未变化的文件不再处理
+func processWatchFile(exepath string, args []string, state *watchState, path string) {
+	if strings.HasPrefix(filepath.Base(path), ".") || !state.changed(path) {
+		return
+	}
+
+	var job *batchJob
+	name := strings.ToLower(path)
+	switch {
+	case isBatchSrt(path):
+		job = newBatchJob(path, true)
+	case strings.HasSuffix(name, ".json"):
+		//json文件修改后重新生成字幕
+		job = newWatchRenderJob(path)
+		args = append(append([]string{}, args...), "-force=true")
+	default:
+		srtpath := watchTrSource(path)
+		if len(srtpath) == 0 {
+			return
+		}
+		//译文修改后重新合并
+		job = newBatchJob(srtpath, false)
+		if job.action != "merge" || job.trpath != path {
+			return
+		}
+		args = append(append([]string{}, args...), "-force=true")
+	}
+	if job == nil {
+		state.record(path)
+		state.save()
+		return
+	}
+
+	if len(job.status) == 0 {
+		runBatchJob(exepath, args, job)
+	}
+	fmt.Fprintln(os.Stderr, time.Now().Format("15:04:05")+"  "+job.status+"  "+job.action+"  "+path+"  "+job.message)
+
+	//本次生成的文件不再作为新文件处理
+	state.record(path)
+	state.record(job.trpath)
+	state.record(job.jspath)
+	state.record(job.outpath)
+	state.save()
+}
+
+//json文件包含译文时重新生成字幕，第一步生成的json文件及编辑中无法读取的json文件不处理
+func newWatchRenderJob(jspath string) *batchJob {
+	project, _, perr := loadProject(jspath)
+	if perr != nil || !project.translated() {
+		return nil
+	}
+	return &batchJob{
+		srtpath: jspath,
+		jspath:  jspath,
+		action:  "render",
+		outpath: templateName(jspath, jsonChsFileName(jspath), langTag(tglang), typeSrt),
+	}
+}
+
+//译文文件对应的原文字幕文件名，不是译文时返回空字符串
+func watchTrSource(trpath string) string {
+	for _, suffix := range batchTrSuffixes {
+		if !strings.HasSuffix(strings.ToLower(trpath), suffix) {
+			continue
+		}
+		srtpath := trpath[0:len(trpath)-len(suffix)] + ".srt"
+		if strings.HasPrefix(suffix, ".srt") {
+			srtpath = trpath[0 : len(trpath)-len(suffix)+4]
+		}
+		if _, serr := os.Stat(srtpath); serr == nil {
+			return srtpath
+		}
+	}
+	return ""
+}
+
+func loadWatchState(statepath string) *watchState {
+	state := &watchState{path: statepath, Files: make(map[string]watchFile)}
+	data, rerr := ioutil.ReadFile(statepath)
+	if rerr != nil {
+		return state
+	}
+	if jerr := json.Unmarshal(data, state); jerr != nil || state.Files == nil {
+		state.Files = make(map[string]watchFile)
+	}
+	return state
+}
+
+func (s *watchState) changed(path string) bool {
+	fi, serr := os.Stat(path)
+	if serr != nil || fi.IsDir() {
+		return false
+	}
+	last, ok := s.Files[filepath.Base(path)]
+	return !ok || last.Size != fi.Size() || !last.ModTime.Equal(fi.ModTime())
+}
+
+func (s *watchState) record(path string) {
+	if len(path) == 0 || path == "-" {
+		return
+	}
+	if fi, serr := os.Stat(path); serr == nil && filepath.Dir(path) == filepath.Dir(s.path) {
+		s.Files[filepath.Base(path)] = watchFile{fi.ModTime(), fi.Size()}
+	}
+}
+
+//状态文件先写入临时文件再改名
+func (s *watchState) save() {
+	data, jerr := json.MarshalIndent(s, "", "  ")
+	checkError(jerr)
+	tmpfile, terr := createTempFile(s.path)
+	checkError(terr)
+	_, werr := tmpfile.Write(data)
+	checkError(werr)
+	checkError(tmpfile.Close())
+	checkError(renameTempFile(tmpfile.Name(), s.path))
+}
+
+//目录内的文件及修改时间，忽略隐藏文件(状态文件、临时文件)
+func scanWatchDir(dir string) map[string]watchFile {
+	files := make(map[string]watchFile)
+	infos, rerr := ioutil.ReadDir(dir)
+	if rerr != nil {
+		return files
+	}
+	for _, fi := range infos {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		files[filepath.Join(dir, fi.Name())] = watchFile{fi.ModTime(), fi.Size()}
+	}
+	return files
+}
+
+//定时扫描目录，用于不支持文件系统通知的系统
+func startPolling(dir string, interval time.Duration, events chan<- string) {
+	go func() {
+		last := scanWatchDir(dir)
+		for {
+			time.Sleep(interval)
+			cur := scanWatchDir(dir)
+			for path, wf := range cur {
+				if old, ok := last[path]; !ok || old.Size != wf.Size || !old.ModTime.Equal(wf.ModTime) {
+					events <- path
+				}
+			}
+			last = cur
+		}
+	}()
+}
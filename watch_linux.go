@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+//使用inotify监视目录，失败时改为定时扫描
+func startWatcher(dir string, interval time.Duration, events chan<- string) string {
+	fd, ierr := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if ierr != nil {
+		startPolling(dir, interval, events)
+		return "polling"
+	}
+	mask := uint32(syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO)
+	if _, werr := syscall.InotifyAddWatch(fd, dir, mask); werr != nil {
+		syscall.Close(fd)
+		startPolling(dir, interval, events)
+		return "polling"
+	}
+
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, rerr := syscall.Read(fd, buf)
+			if rerr == syscall.EINTR {
+				continue
+			}
+			if rerr != nil || n <= 0 {
+				syscall.Close(fd)
+				startPolling(dir, interval, events)
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				offset = start + int(event.Len)
+				if event.Len == 0 || offset > n {
+					continue
+				}
+				name := strings.TrimRight(string(buf[start:offset]), "\x00")
+				if len(name) > 0 {
+					events <- filepath.Join(dir, name)
+				}
+			}
+		}
+	}()
+	return "inotify"
+}
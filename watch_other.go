@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "time"
+
+//其它系统定时扫描目录
+func startWatcher(dir string, interval time.Duration, events chan<- string) string {
+	startPolling(dir, interval, events)
+	return "polling"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchTrSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"A.srt", "B.srt"} {
+		if werr := ioutil.WriteFile(filepath.Join(dir, name), []byte("1\n"), 0644); werr != nil {
+			t.Fatal(werr)
+		}
+	}
+	tests := []struct {
+		trname string
+		want   string
+	}{
+		{"A.srt.chs.txt", "A.srt"},
+		{"B.srt.zh.txt", "B.srt"},
+		{"B.chs.txt", "B.srt"},
+		{"B.zh.txt", "B.srt"},
+		{"C.chs.txt", ""},
+		{"A.srt.en.txt", ""},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if len(want) > 0 {
+			want = filepath.Join(dir, want)
+		}
+		if got := watchTrSource(filepath.Join(dir, tt.trname)); got != want {
+			t.Errorf("watchTrSource(%q) = %q, want %q", tt.trname, got, want)
+		}
+	}
+}
+
+//已处理的文件在修改前不再处理，状态保存在监视目录中
+func TestWatchState(t *testing.T) {
+	dir := t.TempDir()
+	statepath := filepath.Join(dir, watchStateName)
+	srtpath := filepath.Join(dir, "A.srt")
+	if werr := ioutil.WriteFile(srtpath, []byte("1\n"), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	state := loadWatchState(statepath)
+	tests := []struct {
+		name    string
+		change  func()
+		changed bool
+	}{
+		{"new", func() {}, true},
+		{"recorded", func() { state.record(srtpath); state.save() }, false},
+		{"reloaded", func() { state = loadWatchState(statepath) }, false},
+		{"resized", func() { ioutil.WriteFile(srtpath, []byte("12\n"), 0644) }, true},
+		{"touched", func() {
+			state.record(srtpath)
+			os.Chtimes(srtpath, time.Now(), time.Now().Add(time.Hour))
+		}, true},
+		{"removed", func() { os.Remove(srtpath) }, false},
+	}
+	for _, tt := range tests {
+		tt.change()
+		if got := state.changed(srtpath); got != tt.changed {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.changed)
+		}
+	}
+	if files := scanWatchDir(dir); len(files) != 0 {
+		t.Errorf("scanWatchDir listed %v, want the state file ignored", files)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//审校流程状态：机器翻译、译后编辑、已审校、已批准
+var workflowStatuses = map[string]int{
+	"mt":          0,
+	"post-edited": 1,
+	"reviewed":    2,
+	"approved":    3,
+}
+
+//流程状态对应的句子状态(XLIFF)，一一对应
+var statusStates = map[string]string{
+	"mt":          "initial",
+	"post-edited": "translated",
+	"reviewed":    "reviewed",
+	"approved":    "final",
+}
+
+//句子及各行字幕的审校信息，均为可选项
+type workflow struct {
+	Status     string       `json:"status,omitempty"`
+	Assignee   string       `json:"assignee,omitempty"`
+	Modified   string       `json:"modified,omitempty"`
+	ModifiedBy string       `json:"modifiedBy,omitempty"`
+	Comments   []subComment `json:"comments,omitempty"`
+}
+
+type subComment struct {
+	Author   string `json:"author"`
+	Time     string `json:"time"`
+	Text     string `json:"text"`
+	Resolved bool   `json:"resolved,omitempty"`
+}
+
+//当前用户，-user 参数优先，否则使用系统用户名
+func currentUser() string {
+	if len(username) > 0 {
+		return username
+	}
+	for _, name := range []string{"USER", "USERNAME"} {
+		if user := os.Getenv(name); len(user) > 0 {
+			return user
+		}
+	}
+	return "unknown"
+}
+
+func nowTime() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+//记录修改时间及修改人并更新审校状态；译文未修改(changed 为 false)时只提高状态，不降低已批准的句子
+func touchSub(sub *subInfo, status string, changed bool) {
+	sub.Flow.Modified = nowTime()
+	sub.Flow.ModifiedBy = currentUser()
+	if len(status) > 0 && (changed || workflowStatuses[status] > workflowStatuses[sub.Flow.Status]) {
+		sub.Flow.Status = status
+	}
+}
+
+//整句及各行译文，用于判断译文是否被修改
+func subTexts(sub subInfo) string {
+	texts := []string{sub.DCSub}
+	for _, part := range sub.SplitInfo {
+		texts = append(texts, part.SCSub)
+	}
+	return strings.Join(texts, "\n")
+}
+
+//句子状态对应的流程状态，导入CAT工具的审校结果时使用
+func stateStatus(state string) string {
+	for status, s := range statusStates {
+		if s == state {
+			return status
+		}
+	}
+	return ""
+}
+
+//译文仍为机器翻译，未经译后编辑、审校或批准
+func machineTranslated(sub subInfo) bool {
+	if len(sub.DCSub) == 0 {
+		return false
+	}
+	return sub.Flow.Status == "" || sub.Flow.Status == "mt"
+}
+
+//句子已批准时各行均视为已批准
+func lineApproved(sub subInfo, part subpart) bool {
+	return sub.Flow.Status == "approved" || part.Flow.Status == "approved"
+}
+
+//序号列表：3,5-8
+func parsePosList(spec string) (map[int]bool, error) {
+	list := make(map[int]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		from, to := item, item
+		if i := strings.Index(item, "-"); i > 0 {
+			from, to = item[0:i], item[i+1:]
+		}
+		start, serr := strconv.Atoi(strings.TrimSpace(from))
+		end, eerr := strconv.Atoi(strings.TrimSpace(to))
+		if serr != nil || eerr != nil || end < start || end-start > 1000000 {
+			return nil, errors.New("invalid number list \"" + spec + "\", e.g. 3,5-8")
+		}
+		for n := start; n <= end; n++ {
+			list[n] = true
+		}
+	}
+	return list, nil
+}
+
+func mustPosList(flagname, spec string) map[int]bool {
+	if len(spec) == 0 {
+		return nil
+	}
+	list, perr := parsePosList(spec)
+	if perr != nil {
+		fmt.Fprintln(os.Stderr, "-"+flagname+": "+perr.Error())
+		os.Exit(1)
+	}
+	return list
+}
+
+func updateFlow(flow *workflow, user, now string) {
+	if len(setstatus) > 0 {
+		flow.Status = setstatus
+	}
+	if len(assignee) > 0 {
+		flow.Assignee = assignee
+	}
+	if len(commenttext) > 0 {
+		flow.Comments = append(flow.Comments, subComment{Author: user, Time: now, Text: commenttext})
+	}
+	if bresolve {
+		for k := range flow.Comments {
+			flow.Comments[k].Resolved = true
+		}
+	}
+	flow.Modified = now
+	flow.ModifiedBy = user
+}
+
+//设置 -cue 指定句子或 -line 指定行的状态、负责人、评论，未指定时为所有句子
+func UpdateWorkflow() {
+	if _, ok := workflowStatuses[setstatus]; !ok && len(setstatus) > 0 {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "Unknown status: "+setstatus+" (mt post-edited reviewed approved)")
+		} else {
+			fmt.Fprintln(os.Stderr, "未知的状态: "+setstatus+" (mt post-edited reviewed approved)")
+		}
+		os.Exit(1)
+	}
+	cues := mustPosList("cue", cuespec)
+	lines := mustPosList("line", linespec)
+	if len(commenttext) > 0 && cues == nil && lines == nil {
+		if slang == "en" {
+			fmt.Fprintln(os.Stderr, "-comment requires -cue or -line.")
+		} else {
+			fmt.Fprintln(os.Stderr, "-comment 需要 -cue 或 -line 参数.")
+		}
+		os.Exit(1)
+	}
+
+	project := readProject(josnfilepath)
+	allsub := project.subs()
+	user, now := currentUser(), nowTime()
+	updated := 0
+	for i := range allsub {
+		sub := &allsub[i]
+		if lines != nil {
+			for k := range sub.SplitInfo {
+				if lines[sub.SplitInfo[k].SPos+1] {
+					updateFlow(&sub.SplitInfo[k].Flow, user, now)
+					updated++
+				}
+			}
+			continue
+		}
+		if cues != nil && !cues[sub.DPos] {
+			continue
+		}
+		updateFlow(&sub.Flow, user, now)
+		updated++
+	}
+
+	project.setSubs(allsub)
+	if josnfilepath != "-" {
+		saveProject(josnfilepath, project)
+	} else if len(jsoutpath) > 0 {
+		saveProject(jsoutpath, project)
+	}
+	unit := " sentences"
+	zhunit := " 句"
+	if lines != nil {
+		unit, zhunit = " lines", " 行"
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, "Updated "+strconv.Itoa(updated)+unit+" in "+josnfilepath+".")
+	} else {
+		fmt.Fprintln(os.Stderr, "已更新 "+josnfilepath+" 中的 "+strconv.Itoa(updated)+zhunit+".")
+	}
+}
+
+//添加评论，已有相同内容的未解决评论时不重复添加(如再次导入同一表格文件)
+func addComment(flow *workflow, user, now, text string) bool {
+	for _, c := range flow.Comments {
+		if !c.Resolved && c.Text == text {
+			return false
+		}
+	}
+	flow.Comments = append(flow.Comments, subComment{Author: user, Time: now, Text: text})
+	return true
+}
+
+//未解决的评论内容
+func openComments(flow workflow) []string {
+	var texts []string
+	for _, c := range flow.Comments {
+		if !c.Resolved {
+			texts = append(texts, c.Text)
+		}
+	}
+	return texts
+}
+
+func commentLines(prefix string, flow workflow) []string {
+	var list []string
+	for _, c := range flow.Comments {
+		if !c.Resolved {
+			list = append(list, prefix+"  "+c.Time+" "+c.Author+": "+c.Text)
+		}
+	}
+	return list
+}
+
+//列出未解决的评论
+func ListComments() {
+	project := readProject(josnfilepath)
+	var list []string
+	for _, sub := range project.subs() {
+		head := "sentence " + strconv.Itoa(sub.DPos)
+		if len(sub.Flow.Assignee) > 0 {
+			head += " @" + sub.Flow.Assignee
+		}
+		list = append(list, commentLines(head, sub.Flow)...)
+		for _, part := range sub.SplitInfo {
+			linehead := "sentence " + strconv.Itoa(sub.DPos) + " line " + strconv.Itoa(part.SPos+1)
+			if len(part.Flow.Assignee) > 0 {
+				linehead += " @" + part.Flow.Assignee
+			}
+			list = append(list, commentLines(linehead, part.Flow)...)
+		}
+	}
+	if len(list) > 0 {
+		_, werr := os.Stdout.WriteString(strings.Join(list, "\n") + "\n")
+		checkError(werr)
+	}
+	if slang == "en" {
+		fmt.Fprintln(os.Stderr, strconv.Itoa(len(list))+" open comments.")
+	} else {
+		fmt.Fprintln(os.Stderr, "共 "+strconv.Itoa(len(list))+" 条未解决的评论.")
+	}
+}
+
+//未批准的行(字幕序号)
+func unapprovedLines(p *subProject) []string {
+	var list []string
+	for _, sub := range p.subs() {
+		for _, part := range sub.SplitInfo {
+			if !lineApproved(sub, part) {
+				list = append(list, strconv.Itoa(part.SPos+1))
+			}
+		}
+	}
+	return list
+}
+
+//-final 时所有行都需要已批准才生成字幕
+func checkFinal(p *subProject) error {
+	if !bfinal {
+		return nil
+	}
+	if list := unapprovedLines(p); len(list) > 0 {
+		if slang == "en" {
+			return errors.New(strconv.Itoa(len(list)) + " lines are not approved, the final subtitle was not generated: " + joinPos(list))
+		}
+		return errors.New(strconv.Itoa(len(list)) + " 行尚未批准，未生成最终字幕: " + joinPos(list))
+	}
+	return nil
+}
+
+//合并双方的评论，去掉重复的评论
+func mergeComments(ours, theirs []subComment) []subComment {
+	merged := append([]subComment{}, ours...)
+	index := make(map[string]int)
+	for i, c := range merged {
+		index[c.Author+"\x00"+c.Time+"\x00"+c.Text] = i
+	}
+	for _, c := range theirs {
+		if i, ok := index[c.Author+"\x00"+c.Time+"\x00"+c.Text]; ok {
+			merged[i].Resolved = merged[i].Resolved || c.Resolved
+			continue
+		}
+		merged = append(merged, c)
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time < merged[j].Time })
+	return merged
+}
+
+//三方合并审校信息，状态冲突时：译文被修改(changed)取较低的状态，否则保留本方状态
+func mergeFlow(base, ours, theirs workflow, changed bool) workflow {
+	merged := ours
+	if status, ok := merge3(base.Status, ours.Status, theirs.Status); ok {
+		merged.Status = status
+	} else if changed && workflowStatuses[theirs.Status] < workflowStatuses[ours.Status] {
+		merged.Status = theirs.Status
+	}
+	if name, ok := merge3(base.Assignee, ours.Assignee, theirs.Assignee); ok {
+		merged.Assignee = name
+	}
+	if theirs.Modified > ours.Modified {
+		merged.Modified, merged.ModifiedBy = theirs.Modified, theirs.ModifiedBy
+	}
+	merged.Comments = mergeComments(ours.Comments, theirs.Comments)
+	return merged
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+//译文未修改时只提高状态，不降低已批准的句子
+func TestTouchSub(t *testing.T) {
+	tests := []struct {
+		status  string
+		set     string
+		changed bool
+		want    string
+	}{
+		{"mt", "post-edited", true, "post-edited"},
+		{"approved", "post-edited", true, "post-edited"},
+		{"approved", "post-edited", false, "approved"},
+		{"reviewed", "approved", false, "approved"},
+		{"approved", "reviewed", false, "approved"},
+		{"reviewed", "", true, "reviewed"},
+	}
+	for _, tt := range tests {
+		sub := testSubs()[0]
+		sub.Flow.Status = tt.status
+		touchSub(&sub, tt.set, tt.changed)
+		if sub.Flow.Status != tt.want || len(sub.Flow.Modified) == 0 {
+			t.Errorf("touchSub(%s, %q, %v): status %q modified %q, want %q", tt.status, tt.set, tt.changed, sub.Flow.Status, sub.Flow.Modified, tt.want)
+		}
+		if state := cueState(sub); state != statusStates[sub.Flow.Status] {
+			t.Errorf("status %s: state %q", sub.Flow.Status, state)
+		}
+	}
+}
+
+//XLIFF的四种句子状态与审校状态一一对应
+func TestStateStatus(t *testing.T) {
+	tests := []struct {
+		state  string
+		status string
+	}{
+		{"initial", "mt"},
+		{"translated", "post-edited"},
+		{"reviewed", "reviewed"},
+		{"final", "approved"},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		if status := stateStatus(tt.state); status != tt.status {
+			t.Errorf("stateStatus(%s) = %q, want %q", tt.state, status, tt.status)
+		}
+		sub := testSubs()[0]
+		sub.Flow.Status = tt.status
+		if state := cueState(sub); len(tt.status) > 0 && state != tt.state {
+			t.Errorf("cueState(%s) = %q, want %q", tt.status, state, tt.state)
+		}
+	}
+}
+
+//状态冲突时，译文被修改才取较低的状态
+func TestMergeFlow(t *testing.T) {
+	tests := []struct {
+		base, ours, theirs string
+		changed            bool
+		want               string
+	}{
+		{"mt", "approved", "mt", false, "approved"},
+		{"approved", "approved", "reviewed", false, "reviewed"},
+		{"mt", "approved", "post-edited", false, "approved"},
+		{"mt", "approved", "post-edited", true, "post-edited"},
+		{"mt", "post-edited", "approved", true, "post-edited"},
+	}
+	for _, tt := range tests {
+		merged := mergeFlow(workflow{Status: tt.base}, workflow{Status: tt.ours}, workflow{Status: tt.theirs}, tt.changed)
+		if merged.Status != tt.want {
+			t.Errorf("mergeFlow(%s, %s, %s, %v) = %s, want %s", tt.base, tt.ours, tt.theirs, tt.changed, merged.Status, tt.want)
+		}
+	}
+}
+
+func TestParsePosList(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+		ok   bool
+	}{
+		{"3", []int{3}, true},
+		{"3,5-7", []int{3, 5, 6, 7}, true},
+		{" 1 , 2 ", []int{1, 2}, true},
+		{"7-5", nil, false},
+		{"a", nil, false},
+	}
+	for _, tt := range tests {
+		list, perr := parsePosList(tt.spec)
+		if (perr == nil) != tt.ok {
+			t.Errorf("parsePosList(%q): error %v", tt.spec, perr)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		want := make(map[int]bool)
+		for _, n := range tt.want {
+			want[n] = true
+		}
+		if !reflect.DeepEqual(list, want) {
+			t.Errorf("parsePosList(%q) = %v, want %v", tt.spec, list, want)
+		}
+	}
+}
+
+//-final 时句子或所有行都已批准才生成字幕
+func TestCheckFinal(t *testing.T) {
+	keepFlags(t)
+	bfinal = true
+	tests := []struct {
+		sentence string
+		lines    []string
+		wanterr  bool
+	}{
+		{"approved", []string{"", ""}, false},
+		{"reviewed", []string{"approved", "approved"}, false},
+		{"reviewed", []string{"approved", "reviewed"}, true},
+	}
+	for _, tt := range tests {
+		subs := testSubs()
+		subs[0].Flow.Status = "approved"
+		subs[1].Flow.Status = tt.sentence
+		for k, status := range tt.lines {
+			subs[1].SplitInfo[k].Flow.Status = status
+		}
+		if ferr := checkFinal(newProject("-", subs)); (ferr != nil) != tt.wanterr {
+			t.Errorf("sentence %s lines %v: error %v, want error %v", tt.sentence, tt.lines, ferr, tt.wanterr)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	xliffNS = "urn:oasis:names:tc:xliff:document:2.0"
+	mdaNS   = "urn:oasis:names:tc:xliff:metadata:2.0"
+)
+
+//XLIFF 2.0，每句字幕为一个 unit，各行时间轴记录在 metadata 及 notes 中
+var xliffFormat = exchangeFormat{
+	Name:   "XLIFF 2.0",
+	Export: exportXliff,
+	Import: importXliff,
+}
+
+//字幕中的格式标记(<i> {\an8} 等)，导出为 <ph> 以免被翻译
+var inlineTagReg = regexp.MustCompile(`<[^<>]+>|\{\\[^{}]*\}`)
+
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+//一个unit内的格式标记，译文中与原文相同的标记使用相同的id
+type xliffInline struct {
+	data []string
+}
+
+func (x *xliffInline) source(text string) string {
+	return x.replace(text, func(tag string) int {
+		x.data = append(x.data, tag)
+		return len(x.data)
+	})
+}
+
+func (x *xliffInline) target(text string, nsource int) string {
+	used := make(map[int]bool)
+	return x.replace(text, func(tag string) int {
+		for i := 0; i < nsource; i++ {
+			if !used[i] && x.data[i] == tag {
+				used[i] = true
+				return i + 1
+			}
+		}
+		x.data = append(x.data, tag)
+		return len(x.data)
+	})
+}
+
+//文本转义，格式标记替换为 <ph>
+func (x *xliffInline) replace(text string, tagid func(tag string) int) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range inlineTagReg.FindAllStringIndex(text, -1) {
+		b.WriteString(xmlText(text[last:loc[0]]))
+		b.WriteString(x.ph(tagid(text[loc[0]:loc[1]])))
+		last = loc[1]
+	}
+	b.WriteString(xmlText(text[last:]))
+	return b.String()
+}
+
+func (x *xliffInline) ph(id int) string {
+	return `<ph id="` + strconv.Itoa(id) + `" dataRef="d` + strconv.Itoa(id) + `"/>`
+}
+
+func exportXliff(p *subProject) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<xliff xmlns="` + xliffNS + `" xmlns:mda="` + mdaNS + `" version="2.0" srcLang="` +
+		xmlText(p.Languages.Source) + `" trgLang="` + xmlText(p.Languages.Target) + `">` + "\n")
+	b.WriteString(`  <file id="f1" original="` + xmlText(p.Source.File) + `">` + "\n")
+
+	for _, sub := range p.subs() {
+		if len(sub.SplitInfo) == 0 {
+			continue
+		}
+		pos := strconv.Itoa(sub.DPos)
+		b.WriteString(`    <unit id="cue-` + pos + `" name="` + pos + `">` + "\n")
+
+		//各行字幕的序号、时间轴及原文
+		b.WriteString("      <mda:metadata>\n")
+		var lines []string
+		for _, part := range sub.SplitInfo {
+			b.WriteString(`        <mda:metaGroup category="line">` + "\n")
+			b.WriteString(`          <mda:meta type="pos">` + strconv.Itoa(part.SPos) + "</mda:meta>\n")
+			b.WriteString(`          <mda:meta type="time">` + xmlText(part.STime) + "</mda:meta>\n")
+			b.WriteString(`          <mda:meta type="original">` + xmlText(part.SSub) + "</mda:meta>\n")
+			b.WriteString("        </mda:metaGroup>\n")
+			lines = append(lines, "["+part.STime+"] "+part.SSub)
+		}
+		b.WriteString("      </mda:metadata>\n")
+		b.WriteString("      <notes>\n")
+		b.WriteString(`        <note category="lines">` + xmlText(strconv.Itoa(len(lines))+" subtitle lines: "+strings.Join(lines, " | ")) + "</note>\n")
+		b.WriteString("      </notes>\n")
+
+		var inline xliffInline
+		source := inline.source(strings.TrimSpace(sub.DESub))
+		nsource := len(inline.data)
+		target := ""
+		if len(sub.DCSub) > 0 {
+			target = inline.target(sub.DCSub, nsource)
+		}
+		if len(inline.data) > 0 {
+			b.WriteString("      <originalData>\n")
+			for i, data := range inline.data {
+				b.WriteString(`        <data id="d` + strconv.Itoa(i+1) + `">` + xmlText(data) + "</data>\n")
+			}
+			b.WriteString("      </originalData>\n")
+		}
+
+		b.WriteString(`      <segment id="s1" state="` + cueState(sub) + `">` + "\n")
+		b.WriteString("        <source>" + source + "</source>\n")
+		if len(sub.DCSub) > 0 {
+			b.WriteString("        <target>" + target + "</target>\n")
+		}
+		b.WriteString("      </segment>\n")
+		b.WriteString("    </unit>\n")
+	}
+
+	b.WriteString("  </file>\n")
+	b.WriteString("</xliff>\n")
+	return b.Bytes(), nil
+}
+
+func xmlAttr(e xml.StartElement, name string) string {
+	for _, attr := range e.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+//读取各 unit 的译文，格式标记按 originalData 还原；
+//多个 segment 时合并译文，状态取最低的状态
+func importXliff(data []byte) ([]exchangeUnit, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var units []exchangeUnit
+	var unit *exchangeUnit
+	var origdata map[string]string
+	var target strings.Builder
+	var dataid string
+	var datatext strings.Builder
+	var pcrefs []string
+	indata, intarget, hastarget := false, false, false
+	segstate := ""
+	version := ""
+
+	for {
+		token, terr := decoder.Token()
+		if terr == io.EOF {
+			break
+		}
+		if terr != nil {
+			line, _ := decoder.InputPos()
+			return nil, errors.New("line " + strconv.Itoa(line) + ": " + terr.Error())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "xliff":
+				version = xmlAttr(t, "version")
+			case "unit":
+				id := xmlAttr(t, "id")
+				pos, perr := strconv.Atoi(strings.TrimPrefix(id, "cue-"))
+				if perr != nil {
+					line, _ := decoder.InputPos()
+					return nil, errors.New("line " + strconv.Itoa(line) + ": unit id \"" + id + "\" is not a TrSubtitle sentence")
+				}
+				unit = &exchangeUnit{Pos: pos}
+				origdata = make(map[string]string)
+				target.Reset()
+				hastarget = false
+				segstate = ""
+			case "data":
+				indata = true
+				dataid = xmlAttr(t, "id")
+				datatext.Reset()
+			case "segment":
+				state := xmlAttr(t, "state")
+				if unit != nil && (len(segstate) == 0 || cueStates[state] < cueStates[segstate]) {
+					segstate = state
+				}
+			case "target":
+				intarget = true
+				hastarget = true
+			case "ph", "sc", "ec":
+				if intarget {
+					target.WriteString(origdata[xmlAttr(t, "dataRef")])
+				}
+			case "pc":
+				if intarget {
+					target.WriteString(origdata[xmlAttr(t, "dataRefStart")])
+					pcrefs = append(pcrefs, xmlAttr(t, "dataRefEnd"))
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "data":
+				indata = false
+				if origdata != nil {
+					origdata[dataid] = datatext.String()
+				}
+			case "target":
+				intarget = false
+			case "pc":
+				if intarget && len(pcrefs) > 0 {
+					target.WriteString(origdata[pcrefs[len(pcrefs)-1]])
+					pcrefs = pcrefs[0 : len(pcrefs)-1]
+				}
+			case "unit":
+				if unit == nil {
+					continue
+				}
+				unit.Translation = strings.TrimSpace(target.String())
+				unit.State = segstate
+				if _, ok := cueStates[unit.State]; !ok {
+					unit.State = "initial"
+					if hastarget && len(unit.Translation) > 0 {
+						unit.State = "translated"
+					}
+				}
+				units = append(units, *unit)
+				unit = nil
+			}
+		case xml.CharData:
+			if indata {
+				datatext.Write(t)
+			} else if intarget {
+				target.Write(t)
+			}
+		}
+	}
+
+	if !strings.HasPrefix(version, "2.") {
+		return nil, errors.New("not an XLIFF 2.x file (version \"" + version + "\")")
+	}
+	return units, nil
+}
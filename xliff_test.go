@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+//导出的XLIFF文件导入后得到相同的译文及状态，格式标记按原文还原
+func TestXliffRoundTrip(t *testing.T) {
+	keepFlags(t)
+	tests := []struct {
+		status      string
+		translation string
+		state       string
+	}{
+		{"mt", "你好。", "initial"},
+		{"post-edited", "你好。", "translated"},
+		{"reviewed", "<i>你好</i> & {\\an8}再见", "reviewed"},
+		{"approved", "你好。", "final"},
+		{"", "", "initial"},
+	}
+	for _, tt := range tests {
+		subs := testSubs()
+		subs[0].DESub = "<i>Hello</i> & {\\an8}bye \n"
+		subs[0].DCSub, subs[0].Flow.Status = tt.translation, tt.status
+		data, eerr := exportXliff(newProject("Movie.srt", subs))
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		units, ierr := importXliff(data)
+		if ierr != nil {
+			t.Fatalf("status %q: %v\n%s", tt.status, ierr, data)
+		}
+		if len(units) != 2 || units[0].Pos != 1 || units[1].Pos != 2 {
+			t.Fatalf("status %q: units %+v", tt.status, units)
+		}
+		if units[0].Translation != tt.translation || units[0].State != tt.state {
+			t.Errorf("status %q: imported %q %s, want %q %s", tt.status, units[0].Translation, units[0].State, tt.translation, tt.state)
+		}
+		if strings.Contains(string(data), "{\\an8}再见") {
+			t.Errorf("status %q: formatting tags were exported as text", tt.status)
+		}
+	}
+}
+
+func TestImportXliff(t *testing.T) {
+	const head = `<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0"><file id="f1">`
+	tests := []struct {
+		name        string
+		data        string
+		translation string
+		state       string
+		wanterr     string
+	}{
+		{"segments", head + `<unit id="cue-1"><segment state="final"><target>你好，</target></segment>` +
+			`<segment state="translated"><target>再见</target></segment></unit></file></xliff>`, "你好，再见", "translated", ""},
+		{"paired tags", head + `<unit id="cue-1"><originalData><data id="d1">&lt;i&gt;</data><data id="d2">&lt;/i&gt;</data></originalData>` +
+			`<segment><target><pc id="1" dataRefStart="d1" dataRefEnd="d2">你好</pc></target></segment></unit></file></xliff>`, "<i>你好</i>", "translated", ""},
+		{"no state", head + `<unit id="cue-1"><segment><source>Hello</source></segment></unit></file></xliff>`, "", "initial", ""},
+		{"unit id", head + `<unit id="u1"></unit></file></xliff>`, "", "", "not a TrSubtitle sentence"},
+		{"version", `<xliff version="1.2"><file></file></xliff>`, "", "", "not an XLIFF 2.x file"},
+		{"syntax", head + `<unit id="cue-1">`, "", "", "line 1"},
+	}
+	for _, tt := range tests {
+		units, ierr := importXliff([]byte(tt.data))
+		switch {
+		case len(tt.wanterr) > 0:
+			if ierr == nil || !strings.Contains(ierr.Error(), tt.wanterr) {
+				t.Errorf("%s: error %v, want %q", tt.name, ierr, tt.wanterr)
+			}
+		case ierr != nil || len(units) != 1:
+			t.Errorf("%s: units %+v error %v", tt.name, units, ierr)
+		case units[0].Translation != tt.translation || units[0].State != tt.state:
+			t.Errorf("%s: %q %s, want %q %s", tt.name, units[0].Translation, units[0].State, tt.translation, tt.state)
+		}
+	}
+}